@@ -3,28 +3,111 @@ package config
 import (
 	"flag"
 	"github.com/pervukhinpm/link-shortener.git/internal/api"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ServerConfig struct {
 	ServerAddress   api.ServerURL
 	BaseURL         api.ServerURL
 	FileStoragePath string
+	FileStorage     repository.FileRepositoryOptions
+	Cache           repository.CacheOptions
 	DatabaseDSN     string
+	SQLitePath      string
+	DedupeScope     string
+	Canonical       canonical.Options
+	URLValidation   service.URLValidationOptions
+	IDGenerator     string
+	IDLength        int
+	IDSalt          string
+	CleanupInterval time.Duration
+	ClickIPSalt     string
+	HTTPServer      api.ServerOptions
+	ShutdownTimeout time.Duration
+	JWTSecret       string
+	JWTKeysFile     string
+	TokenExp        time.Duration
+	Session         middleware.AuthOptions
+	Tracing         tracing.Options
+	TrustedProxies  []string
 }
 
 func ParseFlags() {
 	var flagServerAddress string
 	var flagBaseURL string
 	var flagFileStoragePath string
+	var flagFileStorage repository.FileRepositoryOptions
+	var flagCache repository.CacheOptions
 	var flagDatabaseDSN string
+	var flagSQLitePath string
+	var flagDedupeScope string
+	var flagCanonical canonical.Options
+	var flagURLValidation service.URLValidationOptions
+	var flagAllowedSchemes string
+	var flagShorteners string
+	var flagIDGenerator string
+	var flagIDLength int
+	var flagIDSalt string
+	var flagCleanupInterval time.Duration
+	var flagClickIPSalt string
+	var flagHTTPServer api.ServerOptions
+	var flagShutdownTimeout time.Duration
+	var flagJWTSecret string
+	var flagJWTKeysFile string
+	var flagTokenExp time.Duration
+	var flagSession middleware.AuthOptions
+	var flagTracing tracing.Options
+	var flagTrustedProxies string
 
 	flag.StringVar(&flagServerAddress, "a", "localhost:8080", "Host Port")
 	flag.StringVar(&flagBaseURL, "b", "http://localhost:8080/", "Base URL")
 	flag.StringVar(&flagFileStoragePath, "f", "/tmp/service-db.json", "File storage path")
+	flag.StringVar(&flagFileStorage.SyncPolicy, "file-sync", repository.SyncAlways, "File storage fsync policy: always, interval, never")
+	flag.DurationVar(&flagFileStorage.SyncInterval, "file-sync-interval", time.Second, "File storage fsync interval for interval policy")
+	flag.IntVar(&flagFileStorage.CompactAfter, "file-compact-after", 10000, "Compact file storage after this many stale records, 0 disables")
+	flag.IntVar(&flagCache.Size, "cache-size", 10000, "Max links in redirect cache, 0 disables")
+	flag.DurationVar(&flagCache.TTL, "cache-ttl", time.Minute, "Redirect cache entry lifetime")
+	flag.DurationVar(&flagCache.NegativeTTL, "cache-negative-ttl", 5*time.Second, "How long to cache unknown short IDs")
 	flag.StringVar(&flagDatabaseDSN, "d", "", "Database DSN")
+	flag.StringVar(&flagSQLitePath, "q", "", "SQLite database path")
+	flag.StringVar(&flagDedupeScope, "dedupe-scope", repository.DedupeGlobal, "Where duplicate original URLs are detected: global, user, none")
+	flag.BoolVar(&flagCanonical.SortQuery, "canonical-sort-query", true, "Sort query parameters when canonicalizing URLs")
+	flag.BoolVar(&flagCanonical.StripTracking, "canonical-strip-tracking", true, "Strip utm_* and click ID parameters when canonicalizing URLs")
+	flag.StringVar(&flagAllowedSchemes, "allowed-schemes", "http,https", "Comma-separated URL schemes accepted for shortening")
+	flag.IntVar(&flagURLValidation.MaxLength, "max-url-length", 2048, "Max length of a shortened URL in bytes, 0 disables")
+	flag.BoolVar(&flagURLValidation.AllowPrivateHosts, "allow-private-hosts", false, "Accept URLs with loopback and private IP hosts")
+	flag.StringVar(&flagShorteners, "blocked-shorteners", strings.Join(service.DefaultShorteners, ","), "Comma-separated shortener domains whose links are rejected")
+	flag.StringVar(&flagIDGenerator, "g", "random", "Short ID generator: random, sequential, hashids, words")
+	flag.IntVar(&flagIDLength, "l", 8, "Short ID length for random generator")
+	flag.StringVar(&flagIDSalt, "s", "", "Salt for hashids generator")
+	flag.DurationVar(&flagCleanupInterval, "r", time.Minute, "Expired links cleanup interval, 0 disables cleanup")
+	flag.StringVar(&flagClickIPSalt, "i", "", "Salt for hashing client IPs in click statistics")
+	flag.DurationVar(&flagHTTPServer.ReadTimeout, "read-timeout", 10*time.Second, "HTTP server read timeout")
+	flag.DurationVar(&flagHTTPServer.ReadHeaderTimeout, "read-header-timeout", 5*time.Second, "HTTP server read header timeout")
+	flag.DurationVar(&flagHTTPServer.WriteTimeout, "write-timeout", 10*time.Second, "HTTP server write timeout")
+	flag.DurationVar(&flagHTTPServer.IdleTimeout, "idle-timeout", 60*time.Second, "HTTP server idle timeout")
+	flag.IntVar(&flagHTTPServer.MaxHeaderBytes, "max-header-bytes", 1<<20, "HTTP server max header size in bytes")
+	flag.DurationVar(&flagShutdownTimeout, "shutdown-timeout", 15*time.Second, "Graceful shutdown timeout")
+	flag.StringVar(&flagJWTSecret, "jwt-secret", "", "HS256 secret for signing auth cookies")
+	flag.StringVar(&flagJWTKeysFile, "jwt-keys-file", "", "JSON file with JWT signing keys for rotation")
+	flag.DurationVar(&flagTokenExp, "token-exp", 3*time.Hour, "Auth token lifetime")
+	flag.BoolVar(&flagSession.SecureCookie, "cookie-secure", false, "Set Secure attribute on auth cookie")
+	flag.DurationVar(&flagSession.RefreshBefore, "session-refresh-before", time.Hour, "Renew auth cookie when it expires sooner than this")
+	flag.DurationVar(&flagSession.ExpiredGrace, "session-grace", 15*time.Minute, "How long after expiry an auth cookie is still renewed for the same user; later a new user is issued, 0 disables renewal of expired cookies")
+
+	flag.StringVar(&flagTracing.Exporter, "trace-exporter", tracing.ExporterNone, "Trace exporter: none, stdout, otlp")
+	flag.StringVar(&flagTracing.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector host:port")
+	flag.BoolVar(&flagTracing.OTLPInsecure, "otlp-insecure", false, "Send traces to OTLP collector over plain HTTP")
+	flag.Float64Var(&flagTracing.SampleRatio, "trace-sample-ratio", 1, "Fraction of new traces to sample")
+	flag.StringVar(&flagTrustedProxies, "trusted-proxies", "", "Comma-separated proxy IPs or CIDRs allowed to set X-Forwarded-For")
 
 	flag.Parse()
 
@@ -40,14 +123,155 @@ func ParseFlags() {
 		flagFileStoragePath = fileStoragePathEnv
 	}
 
+	if fileSyncEnv := os.Getenv("FILE_SYNC"); fileSyncEnv != "" {
+		flagFileStorage.SyncPolicy = fileSyncEnv
+	}
+
+	parseDurationEnv("FILE_SYNC_INTERVAL", &flagFileStorage.SyncInterval)
+	parseIntEnv("FILE_COMPACT_AFTER", &flagFileStorage.CompactAfter)
+
+	parseIntEnv("CACHE_SIZE", &flagCache.Size)
+	parseDurationEnv("CACHE_TTL", &flagCache.TTL)
+	parseDurationEnv("CACHE_NEGATIVE_TTL", &flagCache.NegativeTTL)
+
 	if databaseDSNEnv := os.Getenv("DATABASE_DSN"); databaseDSNEnv != "" {
 		flagDatabaseDSN = databaseDSNEnv
 	}
 
+	if sqlitePathEnv := os.Getenv("SQLITE_PATH"); sqlitePathEnv != "" {
+		flagSQLitePath = sqlitePathEnv
+	}
+
+	if dedupeScopeEnv := os.Getenv("DEDUPE_SCOPE"); dedupeScopeEnv != "" {
+		flagDedupeScope = dedupeScopeEnv
+	}
+
+	parseBoolEnv("CANONICAL_SORT_QUERY", &flagCanonical.SortQuery)
+	parseBoolEnv("CANONICAL_STRIP_TRACKING", &flagCanonical.StripTracking)
+
+	if allowedSchemesEnv := os.Getenv("ALLOWED_SCHEMES"); allowedSchemesEnv != "" {
+		flagAllowedSchemes = allowedSchemesEnv
+	}
+
+	parseIntEnv("MAX_URL_LENGTH", &flagURLValidation.MaxLength)
+	parseBoolEnv("ALLOW_PRIVATE_HOSTS", &flagURLValidation.AllowPrivateHosts)
+
+	if shortenersEnv, ok := os.LookupEnv("BLOCKED_SHORTENERS"); ok {
+		flagShorteners = shortenersEnv
+	}
+
+	if idGeneratorEnv := os.Getenv("ID_GENERATOR"); idGeneratorEnv != "" {
+		flagIDGenerator = idGeneratorEnv
+	}
+
+	parseIntEnv("ID_LENGTH", &flagIDLength)
+
+	if idSaltEnv := os.Getenv("ID_SALT"); idSaltEnv != "" {
+		flagIDSalt = idSaltEnv
+	}
+
+	parseDurationEnv("CLEANUP_INTERVAL", &flagCleanupInterval)
+
+	if clickIPSaltEnv := os.Getenv("CLICK_IP_SALT"); clickIPSaltEnv != "" {
+		flagClickIPSalt = clickIPSaltEnv
+	}
+
+	parseDurationEnv("READ_TIMEOUT", &flagHTTPServer.ReadTimeout)
+	parseDurationEnv("READ_HEADER_TIMEOUT", &flagHTTPServer.ReadHeaderTimeout)
+	parseDurationEnv("WRITE_TIMEOUT", &flagHTTPServer.WriteTimeout)
+	parseDurationEnv("IDLE_TIMEOUT", &flagHTTPServer.IdleTimeout)
+	parseIntEnv("MAX_HEADER_BYTES", &flagHTTPServer.MaxHeaderBytes)
+	parseDurationEnv("SHUTDOWN_TIMEOUT", &flagShutdownTimeout)
+
+	if jwtSecretEnv := os.Getenv("JWT_SECRET"); jwtSecretEnv != "" {
+		flagJWTSecret = jwtSecretEnv
+	}
+
+	if jwtKeysFileEnv := os.Getenv("JWT_KEYS_FILE"); jwtKeysFileEnv != "" {
+		flagJWTKeysFile = jwtKeysFileEnv
+	}
+
+	parseDurationEnv("TOKEN_EXP", &flagTokenExp)
+	parseBoolEnv("COOKIE_SECURE", &flagSession.SecureCookie)
+	parseDurationEnv("SESSION_REFRESH_BEFORE", &flagSession.RefreshBefore)
+	parseDurationEnv("SESSION_GRACE", &flagSession.ExpiredGrace)
+
+	if traceExporterEnv := os.Getenv("TRACE_EXPORTER"); traceExporterEnv != "" {
+		flagTracing.Exporter = traceExporterEnv
+	}
+
+	if otlpEndpointEnv := os.Getenv("OTLP_ENDPOINT"); otlpEndpointEnv != "" {
+		flagTracing.OTLPEndpoint = otlpEndpointEnv
+	}
+
+	parseBoolEnv("OTLP_INSECURE", &flagTracing.OTLPInsecure)
+	parseFloatEnv("TRACE_SAMPLE_RATIO", &flagTracing.SampleRatio)
+
+	if trustedProxiesEnv := os.Getenv("TRUSTED_PROXIES"); trustedProxiesEnv != "" {
+		flagTrustedProxies = trustedProxiesEnv
+	}
+
 	ServerConfig.ServerAddress = *parseServerURL(flagServerAddress)
 	ServerConfig.BaseURL = *parseServerURL(flagBaseURL)
 	ServerConfig.FileStoragePath = flagFileStoragePath
+	ServerConfig.FileStorage = flagFileStorage
+	ServerConfig.Cache = flagCache
 	ServerConfig.DatabaseDSN = flagDatabaseDSN
+	ServerConfig.SQLitePath = flagSQLitePath
+	ServerConfig.DedupeScope = flagDedupeScope
+	ServerConfig.Canonical = flagCanonical
+	flagURLValidation.AllowedSchemes = strings.Split(flagAllowedSchemes, ",")
+	if flagShorteners != "" {
+		flagURLValidation.Shorteners = strings.Split(flagShorteners, ",")
+	}
+	ServerConfig.URLValidation = flagURLValidation
+	ServerConfig.IDGenerator = flagIDGenerator
+	ServerConfig.IDLength = flagIDLength
+	ServerConfig.IDSalt = flagIDSalt
+	ServerConfig.CleanupInterval = flagCleanupInterval
+	ServerConfig.ClickIPSalt = flagClickIPSalt
+	ServerConfig.HTTPServer = flagHTTPServer
+	ServerConfig.ShutdownTimeout = flagShutdownTimeout
+	ServerConfig.JWTSecret = flagJWTSecret
+	ServerConfig.JWTKeysFile = flagJWTKeysFile
+	ServerConfig.TokenExp = flagTokenExp
+	ServerConfig.Session = flagSession
+	ServerConfig.Tracing = flagTracing
+	if flagTrustedProxies != "" {
+		ServerConfig.TrustedProxies = strings.Split(flagTrustedProxies, ",")
+	}
+}
+
+func parseIntEnv(name string, value *int) {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.Atoi(env); err == nil {
+			*value = parsed
+		}
+	}
+}
+
+func parseBoolEnv(name string, value *bool) {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.ParseBool(env); err == nil {
+			*value = parsed
+		}
+	}
+}
+
+func parseFloatEnv(name string, value *float64) {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.ParseFloat(env, 64); err == nil {
+			*value = parsed
+		}
+	}
+}
+
+func parseDurationEnv(name string, value *time.Duration) {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := time.ParseDuration(env); err == nil {
+			*value = parsed
+		}
+	}
 }
 
 func parseServerURL(rawURL string) *api.ServerURL {
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"testing"
+)
+
+func TestBaseURLSelfReference(t *testing.T) {
+	baseURL := parseServerURL("https://sho.rt")
+	validator, err := service.NewURLValidator(service.URLValidationOptions{
+		AllowedSchemes: []string{"http", "https"},
+		BaseURL:        baseURL.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalidURLErr := new(errs.InvalidURL)
+	if err := validator.Validate("https://sho.rt/x"); !errors.As(err, &invalidURLErr) || invalidURLErr.Rule != errs.URLRuleSelfReference {
+		t.Errorf("Validate() error = %v, want rule %s", err, errs.URLRuleSelfReference)
+	}
+}
@@ -1,49 +1,210 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/pervukhinpm/link-shortener.git/cmd/config"
 	"github.com/pervukhinpm/link-shortener.git/internal/api"
 	"github.com/pervukhinpm/link-shortener.git/internal/db"
+	"github.com/pervukhinpm/link-shortener.git/internal/jwt"
+	"github.com/pervukhinpm/link-shortener.git/internal/metrics"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
 	"github.com/pervukhinpm/link-shortener.git/internal/repository"
 	"github.com/pervukhinpm/link-shortener.git/internal/service"
-	"log"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
 	middleware.Initialize()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	config.ParseFlags()
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, config.ServerConfig.Tracing)
+	if err != nil {
+		middleware.Log.Errorw("Failed to set up tracing", "error", err)
+		return
+	}
+
 	database, err := db.NewDB(config.ServerConfig.DatabaseDSN)
 	if err != nil {
-		middleware.Log.Error("Failed to create database: %v", err)
+		middleware.Log.Errorw("Failed to create database", "error", err)
 		return
 	}
+	defer database.Close()
 
 	appRepository, err := repository.NewRepository(
 		config.ServerConfig.DatabaseDSN,
+		config.ServerConfig.SQLitePath,
 		config.ServerConfig.FileStoragePath,
+		config.ServerConfig.FileStorage,
+		config.ServerConfig.DedupeScope,
 		database,
 	)
 
 	if err != nil {
-		middleware.Log.Error("Failed to initialize repository: %v", err)
+		middleware.Log.Errorw("Failed to initialize repository", "error", err)
 		return
 	}
 
 	defer func(appRepository repository.Repository) {
 		err := appRepository.Close()
 		if err != nil {
-			middleware.Log.Error("Failed to close repository: %v", err)
+			middleware.Log.Errorw("Failed to close repository", "error", err)
 		}
 	}(appRepository)
 
-	urlService := service.NewURLService(appRepository)
-	shortenerHandler := api.NewHandler(urlService, config.ServerConfig.BaseURL)
+	appRepository = repository.NewInstrumentedRepository(appRepository)
+	if config.ServerConfig.Cache.Size > 0 {
+		cachedRepository := repository.NewCachedRepository(appRepository, config.ServerConfig.Cache)
+		repository.RegisterCacheMetrics(cachedRepository)
+		appRepository = cachedRepository
+	}
+	if config.ServerConfig.DatabaseDSN != "" {
+		metrics.RegisterPool(database)
+	}
+	metrics.RegisterDeleteQueueDepth(appRepository.CountActiveDeleteJobs)
+
+	idGenerator, err := service.NewIDGenerator(
+		config.ServerConfig.IDGenerator,
+		config.ServerConfig.IDLength,
+		config.ServerConfig.IDSalt,
+	)
+	if err != nil {
+		middleware.Log.Errorw("Failed to create id generator", "error", err)
+		return
+	}
+
+	tokenManager, err := newTokenManager()
+	if err != nil {
+		middleware.Log.Errorw("Failed to load JWT keys", "error", err)
+		return
+	}
+
+	// Фоновые воркеры останавливаются только после того, как сервер дообработал запросы,
+	// чтобы клики и задачи удаления из последних запросов не потерялись.
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workersCtx)
+		}()
+	}
+
+	urlValidationOptions := config.ServerConfig.URLValidation
+	urlValidationOptions.BaseURL = config.ServerConfig.BaseURL.String()
+	urlValidator, err := service.NewURLValidator(urlValidationOptions)
+	if err != nil {
+		middleware.Log.Errorw("Failed to configure url validation", "error", err)
+		return
+	}
+	urlService := service.NewURLService(
+		appRepository,
+		idGenerator,
+		config.ServerConfig.DedupeScope,
+		config.ServerConfig.Canonical,
+		urlValidator,
+	)
+	expirationReaper := service.NewExpirationReaper(appRepository, config.ServerConfig.CleanupInterval)
+	runWorker(expirationReaper.Run)
+	deleteWorker := service.NewDeleteWorker(appRepository)
+	runWorker(deleteWorker.Run)
+
+	statsService := service.NewStatsService(appRepository, config.ServerConfig.ClickIPSalt)
+	runWorker(statsService.Run)
+
+	shortenerHandler := api.NewHandler(urlService, statsService, config.ServerConfig.BaseURL)
+	statsHandler := api.NewStatsHandler(statsService, config.ServerConfig.BaseURL)
 	ping := service.NewPingService(database)
 	databaseHandler := api.NewDatabaseHealthHandler(ping)
-	router := api.Router(databaseHandler, shortenerHandler)
-	server := api.NewServer(&config.ServerConfig.ServerAddress, router)
+	apiKeyService := service.NewAPIKeyService(appRepository)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyService)
+	tagHandler := api.NewTagHandler(service.NewTagService(appRepository))
+	authenticator := middleware.NewAuthenticator(tokenManager, apiKeyService, config.ServerConfig.Session)
+	clientIPResolver, err := middleware.NewClientIPResolver(config.ServerConfig.TrustedProxies)
+	if err != nil {
+		middleware.Log.Errorw("Failed to parse trusted proxies", "error", err)
+		return
+	}
+	router := api.Router(authenticator, databaseHandler, shortenerHandler, statsHandler, apiKeyHandler, tagHandler, clientIPResolver)
+	server := api.NewServer(&config.ServerConfig.ServerAddress, router, config.ServerConfig.HTTPServer)
+
+	go func() {
+		if err := server.Start(); err != nil {
+			middleware.Log.Errorw("Server failed", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	middleware.Log.Info("Shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.ServerConfig.ShutdownTimeout)
+	defer cancelShutdown()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		middleware.Log.Errorw("Failed to shutdown server gracefully", "error", err)
+	}
+
+	cancelWorkers()
+	waitWorkers(shutdownCtx, &workers)
+
+	// Последними отправляем спаны, в том числе от воркеров
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		middleware.Log.Errorw("Failed to flush traces", "error", err)
+	}
+}
+
+func waitWorkers(ctx context.Context, workers *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		middleware.Log.Warn("Background workers did not stop before shutdown deadline")
+	}
+}
+
+func newTokenManager() (*jwt.Manager, error) {
+	var keySet *jwt.KeySet
+	var err error
+
+	switch {
+	case config.ServerConfig.JWTKeysFile != "":
+		keySet, err = jwt.LoadKeySetFile(config.ServerConfig.JWTKeysFile)
+	case config.ServerConfig.JWTSecret != "":
+		keySet = &jwt.KeySet{
+			ActiveKeyID: "default",
+			Keys:        []*jwt.Key{jwt.NewHMACKey("default", []byte(config.ServerConfig.JWTSecret))},
+		}
+	default:
+		middleware.Log.Warn("JWT signing key is not configured, using ephemeral key: sessions will not survive restart")
+		keySet, err = jwt.NewRandomKeySet()
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	log.Fatal(server.Start())
+	return jwt.NewManager(keySet, config.ServerConfig.TokenExp)
 }
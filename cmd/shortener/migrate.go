@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/internal/db"
+	"os"
+	"time"
+)
+
+const migrateUsage = `usage: shortener migrate <up|down|status> [-d DSN] [-steps N]
+
+  up      apply all pending migrations
+  down    roll back the last N applied migrations (default 1)
+  status  list migrations and whether they are applied`
+
+// runMigrate обслуживает подкоманду `shortener migrate`; DSN берётся из -d или DATABASE_DSN.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command := args[0]
+	if command != "up" && command != "down" && command != "status" {
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	dsn := flags.String("d", os.Getenv("DATABASE_DSN"), "Database DSN")
+	steps := flags.Int("steps", 1, "Number of migrations to roll back")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		return errors.New("database DSN is required: pass -d or set DATABASE_DSN")
+	}
+
+	ctx := context.Background()
+	pool, err := db.NewDB(*dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := db.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps must be positive")
+		}
+		rolledBack, err := migrator.Down(ctx, *steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	}
+	return nil
+}
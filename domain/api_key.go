@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+const (
+	ScopeCreate = "create"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+)
+
+var AllScopes = []string{ScopeCreate, ScopeRead, ScopeDelete}
+
+type APIKey struct {
+	ID        string
+	UserID    string
+	Name      string
+	KeyHash   string
+	Prefix    string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// HasScope считает ключ без явно заданных скоупов ключом с полным доступом.
+func (k *APIKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
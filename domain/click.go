@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+type Click struct {
+	ShortURL  string
+	ClickedAt time.Time
+	Referrer  string
+	UserAgent string
+	IPHash    string
+}
+
+type ClickStats struct {
+	ShortURL       string
+	TotalClicks    int64
+	UniqueVisitors int64
+	Daily          []DailyClicks
+}
+
+type DailyClicks struct {
+	Day    time.Time
+	Clicks int64
+}
@@ -0,0 +1,51 @@
+package domain
+
+import "time"
+
+const (
+	DeleteJobPending = "pending"
+	DeleteJobRunning = "running"
+	DeleteJobDone    = "done"
+	DeleteJobFailed  = "failed"
+)
+
+const (
+	DeleteItemPending  = "pending"
+	DeleteItemDeleted  = "deleted"
+	DeleteItemNotFound = "not_found"
+)
+
+type DeleteJob struct {
+	ID        string
+	UserID    string
+	Status    string
+	Attempts  int
+	LastError string
+	// RunAfter — время, раньше которого задачу нельзя брать в работу:
+	// задержка перед повторной попыткой или срок аренды у воркера.
+	RunAfter  time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Items     []DeleteJobItem
+}
+
+type DeleteJobItem struct {
+	ShortURL string
+	Status   string
+}
+
+func NewDeleteJob(id, userID string, shortURLs []string, now time.Time) *DeleteJob {
+	items := make([]DeleteJobItem, len(shortURLs))
+	for i, shortURL := range shortURLs {
+		items[i] = DeleteJobItem{ShortURL: shortURL, Status: DeleteItemPending}
+	}
+	return &DeleteJob{
+		ID:        id,
+		UserID:    userID,
+		Status:    DeleteJobPending,
+		RunAfter:  now,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Items:     items,
+	}
+}
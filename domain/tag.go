@@ -0,0 +1,7 @@
+package domain
+
+type TagCount struct {
+	Name string
+	// Count — число неудалённых ссылок с этим тегом.
+	Count int64
+}
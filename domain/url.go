@@ -1,12 +1,30 @@
 package domain
 
+import "time"
+
 type URL struct {
 	ID          string
 	OriginalURL string
 	UserID      string
 	IsDeleted   bool
+	ExpiresAt   *time.Time
+	CreatedAt   time.Time
+	// Tags отсортированы и не повторяются.
+	Tags []string
+	// CanonicalURL — канонический вид OriginalURL, по нему ищутся дубли.
+	// Пуст у ссылок, сохранённых до появления канонизации.
+	CanonicalURL string
 }
 
 func NewURL(id, originalURL string, userID string, IsDeleted bool) *URL {
-	return &URL{id, originalURL, userID, IsDeleted}
+	return &URL{
+		ID:          id,
+		OriginalURL: originalURL,
+		UserID:      userID,
+		IsDeleted:   IsDeleted,
+	}
+}
+
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"net/http"
+	"strings"
+)
+
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyServiceManager
+}
+
+func NewAPIKeyHandler(apiKeyService service.APIKeyServiceManager) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") {
+		http.Error(w, "Only application/json supported Media Type!", http.StatusBadRequest)
+		return
+	}
+
+	var createBody model.CreateAPIKeyBody
+	if err := json.NewDecoder(r.Body).Decode(&createBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, rawKey, err := h.apiKeyService.Create(r.Context(), createBody.Name, createBody.Scopes)
+	if err != nil {
+		if errors.Is(err, errs.ErrInvalidAPIKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("failed to create api key", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newAPIKeyResponse(key)
+	response.Key = rawKey
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.List(r.Context())
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("failed to list api keys", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]model.APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = newAPIKeyResponse(&keys[i])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID := chi.URLParam(r, "id")
+
+	err := h.apiKeyService.Revoke(r.Context(), keyID)
+	if err != nil {
+		if errors.Is(err, errs.ErrAPIKeyNotFound) {
+			http.Error(w, "API key not found!", http.StatusNotFound)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("failed to revoke api key", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAPIKeyResponse(key *domain.APIKey) model.APIKeyResponse {
+	scopes := key.Scopes
+	if len(scopes) == 0 {
+		scopes = domain.AllScopes
+	}
+	return model.APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		middleware.Log.Errorw("error to create response", "error", err)
+		return
+	}
+}
@@ -2,33 +2,76 @@ package api
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/metrics"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
 )
 
 func Router(
+	authenticator *middleware.Authenticator,
 	databaseHealthHandler *DatabaseHealthHandler,
 	shortenerHandler *ShortenerHandler,
+	statsHandler *StatsHandler,
+	apiKeyHandler *APIKeyHandler,
+	tagHandler *TagHandler,
+	clientIPResolver *middleware.ClientIPResolver,
 ) chi.Router {
 	r := chi.NewRouter()
 
+	r.Use(tracing.Middleware)
+	r.Use(middleware.RequestID)
+	r.Use(clientIPResolver.Middleware)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Gzip)
 
 	// Публичные маршруты (без аутентификации)
 	r.Group(func(r chi.Router) {
 		r.Get("/ping", databaseHealthHandler.PingDatabase)
+		r.Handle("/metrics", metrics.Handler())
 	})
 
 	// Маршруты, требующие аутентификации
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.Auth)
+		r.Use(authenticator.Auth)
 
-		r.Post("/", shortenerHandler.CreateShortenerURL)
 		r.Get("/{id}", shortenerHandler.GetShortenerURL)
-		r.Post("/api/shorten", shortenerHandler.CreateJSONShortenerURL)
-		r.Post("/api/shorten/batch", shortenerHandler.BatchCreateJSONShortenerURL)
-		r.Get("/api/user/urls", shortenerHandler.getURLsByUser)
-		r.Delete("/api/user/urls", shortenerHandler.DeleteURLBatchByUser)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(domain.ScopeCreate))
+
+			r.Post("/", shortenerHandler.CreateShortenerURL)
+			r.Post("/api/shorten", shortenerHandler.CreateJSONShortenerURL)
+			r.Post("/api/shorten/batch", shortenerHandler.BatchCreateJSONShortenerURL)
+			r.Patch("/api/user/urls/{id}", shortenerHandler.UpdateUserURL)
+			r.Patch("/api/user/tags/{name}", tagHandler.RenameTag)
+			r.Post("/api/user/tags/merge", tagHandler.MergeTags)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(domain.ScopeRead))
+
+			r.Get("/api/user/urls", shortenerHandler.getURLsByUser)
+			r.Get("/api/user/urls/{id}/stats", statsHandler.GetURLStats)
+			r.Get("/api/user/jobs/{id}", shortenerHandler.GetDeleteJob)
+			r.Get("/api/user/tags", tagHandler.ListTags)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(domain.ScopeDelete))
+
+			r.Delete("/api/user/urls", shortenerHandler.DeleteURLBatchByUser)
+		})
+
+		// Управлять ключами можно только из сессии, но не другим ключом
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireSession)
+
+			r.Post("/api/user/keys", apiKeyHandler.CreateAPIKey)
+			r.Get("/api/user/keys", apiKeyHandler.ListAPIKeys)
+			r.Delete("/api/user/keys/{id}", apiKeyHandler.RevokeAPIKey)
+		})
 	})
 
 	return r
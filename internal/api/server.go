@@ -1,23 +1,50 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"time"
 )
 
+type ServerOptions struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
 type Server struct {
-	router    chi.Router
-	serverURL *ServerURL
+	httpServer *http.Server
 }
 
-func NewServer(serverURL *ServerURL, router chi.Router) *Server {
+func NewServer(serverURL *ServerURL, router chi.Router, options ServerOptions) *Server {
 	return &Server{
-		router:    router,
-		serverURL: serverURL,
+		httpServer: &http.Server{
+			Addr:              fmt.Sprintf(":%d", serverURL.Port),
+			Handler:           router,
+			ReadTimeout:       options.ReadTimeout,
+			ReadHeaderTimeout: options.ReadHeaderTimeout,
+			WriteTimeout:      options.WriteTimeout,
+			IdleTimeout:       options.IdleTimeout,
+			MaxHeaderBytes:    options.MaxHeaderBytes,
+		},
 	}
 }
 
+// Start блокируется до остановки сервера. После вызова Shutdown возвращает nil.
 func (s *Server) Start() error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", s.serverURL.Port), s.router)
+	err := s.httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown перестаёт принимать новые соединения и ждёт завершения активных запросов до дедлайна ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
@@ -6,26 +6,34 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	"github.com/pervukhinpm/link-shortener.git/domain"
 	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/metrics"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
 	"github.com/pervukhinpm/link-shortener.git/internal/model"
 	"github.com/pervukhinpm/link-shortener.git/internal/service"
-	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ShortenerHandler struct {
-	urlService service.ShortenerServiceReaderWriter
-	baseURL    ServerURL
+	urlService    service.ShortenerServiceReaderWriter
+	clickRecorder service.ClickRecorder
+	baseURL       ServerURL
 }
 
-func NewHandler(urlService service.ShortenerServiceReaderWriter, baseURL ServerURL) *ShortenerHandler {
+func NewHandler(
+	urlService service.ShortenerServiceReaderWriter,
+	clickRecorder service.ClickRecorder,
+	baseURL ServerURL,
+) *ShortenerHandler {
 	return &ShortenerHandler{
-		urlService: urlService,
-		baseURL:    baseURL,
+		urlService:    urlService,
+		clickRecorder: clickRecorder,
+		baseURL:       baseURL,
 	}
 }
 
@@ -58,9 +66,15 @@ func (h *ShortenerHandler) CreateShortenerURL(w http.ResponseWriter, r *http.Req
 			}
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if invalidURLErr := new(errs.InvalidURL); errors.As(err, &invalidURLErr) {
+			writeInvalidURL(w, invalidURLErr)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("create shortener failed", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	metrics.LinksCreated.WithLabelValues(metrics.SourceSingle).Inc()
 
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "text/plain")
@@ -77,21 +91,23 @@ func (h *ShortenerHandler) GetShortenerURL(w http.ResponseWriter, r *http.Reques
 	}
 	shortID := chi.URLParam(r, "id")
 
-	deleted, err := h.urlService.GetFlagByShortURL(r.Context(), shortID)
+	origURL, err := h.urlService.Resolve(r.Context(), shortID)
 	if err != nil {
+		if errors.Is(err, errs.ErrURLDeleted) {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if errors.Is(err, errs.ErrURLNotFound) {
+			http.Error(w, "URL not found!", http.StatusBadRequest)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("failed to resolve url", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if deleted {
-		w.WriteHeader(http.StatusGone)
-		return
-	}
 
-	origURL, err := h.urlService.Find(shortID, r.Context())
-	if err != nil {
-		http.Error(w, "URL not found!", http.StatusBadRequest)
-		return
-	}
+	metrics.Redirects.Inc()
+	h.clickRecorder.Record(shortID, r.Referer(), r.UserAgent(), middleware.GetClientIP(r))
 
 	w.Header().Set("Location", origURL.OriginalURL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
@@ -128,11 +144,33 @@ func (h *ShortenerHandler) CreateJSONShortenerURL(w http.ResponseWriter, r *http
 		return
 	}
 
-	shortURL, err := h.urlService.Shorten(createShortenerBody.URL, r.Context())
+	shortenOptions := service.ShortenOptions{
+		Alias:     createShortenerBody.Alias,
+		ExpiresAt: createShortenerBody.ExpiresAt,
+		TTL:       createShortenerBody.TTL,
+		Tags:      createShortenerBody.Tags,
+	}
+	shortURL, err := h.urlService.ShortenWithOptions(createShortenerBody.URL, shortenOptions, r.Context())
 
 	if err != nil {
+		if invalidAliasErr := new(errs.InvalidAlias); errors.As(err, &invalidAliasErr) {
+			http.Error(w, invalidAliasErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if invalidURLErr := new(errs.InvalidURL); errors.As(err, &invalidURLErr) {
+			writeInvalidURL(w, invalidURLErr)
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidExpiry) || errors.Is(err, errs.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if takenErr := new(errs.ShortURLAlreadyExists); errors.As(err, &takenErr) {
+			http.Error(w, takenErr.Error(), http.StatusConflict)
+			return
+		}
 		if existingErr := new(errs.OriginalURLAlreadyExists); errors.As(err, &existingErr) {
-			middleware.Log.Info("original url already exists", zap.String("url", existingErr.URL.OriginalURL))
+			middleware.LogFromContext(r.Context()).Infow("original url already exists", "url", existingErr.URL.OriginalURL)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusConflict)
 			result := fmt.Sprintf("%s/%s", h.baseURL.String(), existingErr.URL.ID)
@@ -148,11 +186,13 @@ func (h *ShortenerHandler) CreateJSONShortenerURL(w http.ResponseWriter, r *http
 			}
 			return
 		}
-		middleware.Log.Error("create shortener failed", zap.Error(err))
+		middleware.LogFromContext(r.Context()).Errorw("create shortener failed", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	metrics.LinksCreated.WithLabelValues(metrics.SourceSingle).Inc()
+
 	result := fmt.Sprintf("%s/%s", h.baseURL.String(), shortURL.ID)
 	response := model.CreateShortenerResponse{Result: result}
 
@@ -200,36 +240,61 @@ func (h *ShortenerHandler) BatchCreateJSONShortenerURL(w http.ResponseWriter, r
 	}
 
 	batchRequestCount := len(batchRequestBody.BatchList)
-	urls := make([]domain.URL, batchRequestCount)
-
-	userID := middleware.GetUserID(r.Context())
+	metrics.BatchSize.WithLabelValues(metrics.BatchShorten).Observe(float64(batchRequestCount))
 
+	items := make([]service.BatchItem, batchRequestCount)
 	for i, v := range batchRequestBody.BatchList {
-		urls[i] = *domain.NewURL(v.CorrelationID, v.OriginalURL, userID, false)
+		items[i] = service.BatchItem{
+			CorrelationID: v.CorrelationID,
+			OriginalURL:   v.OriginalURL,
+			ExpiresAt:     v.ExpiresAt,
+			TTL:           v.TTL,
+			Tags:          v.Tags,
+		}
 	}
 
-	err = h.urlService.AddBatch(urls, r.Context())
+	results, err := h.urlService.ShortenBatch(r.Context(), items)
 	if err != nil {
-		middleware.Log.Error("Shortener.BatchCreateJSONShortenerURL: " + err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		middleware.LogFromContext(r.Context()).Errorw("failed to shorten batch", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	respData := make([]model.BatchResponseItem, batchRequestCount)
-	for i, v := range urls {
+	created := 0
+	respData := make([]model.BatchResponseItem, len(results))
+	for i, result := range results {
 		respData[i] = model.BatchResponseItem{
-			CorrelationID: v.ID,
-			ShortURL:      fmt.Sprintf("%s/%s", h.baseURL.String(), v.ID),
+			CorrelationID: result.CorrelationID,
+			Status:        result.Status,
+		}
+		if result.URL != nil {
+			respData[i].ShortURL = fmt.Sprintf("%s/%s", h.baseURL.String(), result.URL.ID)
+		}
+		if result.Err != nil {
+			respData[i].Error = result.Err.Error()
+			if invalidURLErr := new(errs.InvalidURL); errors.As(result.Err, &invalidURLErr) {
+				respData[i].Rule = invalidURLErr.Rule
+			}
+		}
+		if result.Status == model.BatchItemCreated {
+			created++
 		}
 	}
+	metrics.LinksCreated.WithLabelValues(metrics.SourceBatch).Add(float64(created))
+
 	jsonResp, err := json.Marshal(respData)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// 201 только если пакет действительно что-то создал
+	status := http.StatusOK
+	if created > 0 {
+		status = http.StatusCreated
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	_, err = w.Write(jsonResp)
 	if err != nil {
 		return
@@ -238,22 +303,37 @@ func (h *ShortenerHandler) BatchCreateJSONShortenerURL(w http.ResponseWriter, r
 
 func (h *ShortenerHandler) getURLsByUser(w http.ResponseWriter, r *http.Request) {
 	_, err := r.Cookie(middleware.CookieName)
-	if err != nil {
+	if err != nil && middleware.GetAPIKey(r.Context()) == nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	urls, err := h.urlService.GetByUserID(r.Context())
+	options, err := parseListURLsOptions(r.URL.Query())
 	if err != nil {
-		middleware.Log.Error("error to get url")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.urlService.ListUserURLs(r.Context(), options)
+	if err != nil {
+		if errors.Is(err, errs.ErrInvalidPage) || errors.Is(err, errs.ErrInvalidTag) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("failed to list urls", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	var shortURLBatch []model.URLByUserBatchResponseItem
-	for _, url := range *urls {
+	for _, url := range page.URLs {
 		shortURLBatch = append(shortURLBatch, model.URLByUserBatchResponseItem{
-			ShortURL:    fmt.Sprintf("%s/%s", h.baseURL.String(), url.ID),
-			OriginalURL: url.OriginalURL,
+			ShortURL:     fmt.Sprintf("%s/%s", h.baseURL.String(), url.ID),
+			OriginalURL:  url.OriginalURL,
+			CanonicalURL: url.CanonicalURL,
+			CreatedAt:    url.CreatedAt,
+			ExpiresAt:    url.ExpiresAt,
+			IsDeleted:    url.IsDeleted,
+			Tags:         url.Tags,
 		})
 	}
 
@@ -262,17 +342,73 @@ func (h *ShortenerHandler) getURLsByUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s?%s>; rel="next"`, h.baseURL.String(), r.URL.Path, next.Encode()))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	err = json.NewEncoder(w).Encode(shortURLBatch)
 	if err != nil {
-		middleware.Log.Error("error to create response", zap.String("err", err.Error()))
+		middleware.LogFromContext(r.Context()).Errorw("error to create response", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 }
 
+// parseListURLsOptions разбирает параметры GET /api/user/urls: limit, cursor,
+// sort (created_at или -created_at, по умолчанию сначала новые), include_deleted, q,
+// created_after и created_before в RFC 3339.
+func parseListURLsOptions(query url.Values) (service.ListURLsOptions, error) {
+	options := service.ListURLsOptions{
+		Cursor:     query.Get("cursor"),
+		Search:     query.Get("q"),
+		Tag:        query.Get("tag"),
+		Descending: true,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return options, fmt.Errorf("invalid limit %q", limit)
+		}
+		options.Limit = parsed
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "", "-created_at":
+	case "created_at":
+		options.Descending = false
+	default:
+		return options, fmt.Errorf("unsupported sort %q", sort)
+	}
+
+	if includeDeleted := query.Get("include_deleted"); includeDeleted != "" {
+		parsed, err := strconv.ParseBool(includeDeleted)
+		if err != nil {
+			return options, fmt.Errorf("invalid include_deleted %q", includeDeleted)
+		}
+		options.IncludeDeleted = parsed
+	}
+
+	for name, target := range map[string]**time.Time{
+		"created_after":  &options.CreatedAfter,
+		"created_before": &options.CreatedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return options, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = &parsed
+		}
+	}
+
+	return options, nil
+}
+
 func (h *ShortenerHandler) DeleteURLBatchByUser(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/json" {
@@ -297,8 +433,127 @@ func (h *ShortenerHandler) DeleteURLBatchByUser(w http.ResponseWriter, r *http.R
 		return
 	}
 	deleteBatch.UserID = userID
+	metrics.BatchSize.WithLabelValues(metrics.BatchDelete).Observe(float64(len(deleteBatch.ShortenedURL)))
 
-	go h.urlService.DeleteURLBatch(r.Context(), deleteBatch)
+	job, err := h.urlService.DeleteURLBatch(r.Context(), deleteBatch)
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("failed to enqueue delete job", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
+
+	err = json.NewEncoder(w).Encode(model.DeleteJobAcceptedResponse{JobID: job.ID, Status: job.Status})
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("error to create response", "error", err)
+		return
+	}
+}
+
+func (h *ShortenerHandler) GetDeleteJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+
+	job, err := h.urlService.GetDeleteJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, errs.ErrJobNotFound) {
+			http.Error(w, "Job not found!", http.StatusNotFound)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("failed to get delete job", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := model.DeleteJobResponse{
+		JobID:     job.ID,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		LastError: job.LastError,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+		Items:     make([]model.DeleteJobResponseItem, len(job.Items)),
+	}
+	for i, item := range job.Items {
+		response.Items[i] = model.DeleteJobResponseItem{ShortURL: item.ShortURL, Status: item.Status}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("error to create response", "error", err)
+		return
+	}
+}
+
+func (h *ShortenerHandler) UpdateUserURL(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") {
+		http.Error(w, "Only application/json supported Media Type!", http.StatusBadRequest)
+		return
+	}
+
+	shortID := chi.URLParam(r, "id")
+
+	var updateBody model.UpdateURLBody
+	if err := json.NewDecoder(r.Body).Decode(&updateBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updateOptions := service.UpdateOptions{
+		OriginalURL: updateBody.OriginalURL,
+		ExpiresAt:   updateBody.ExpiresAt.Value,
+		TTL:         updateBody.TTL,
+		ClearExpiry: updateBody.ExpiresAt.Set && updateBody.ExpiresAt.Value == nil,
+		Tags:        updateBody.Tags,
+	}
+	url, err := h.urlService.Update(r.Context(), shortID, updateOptions)
+	if err != nil {
+		invalidURLErr := new(errs.InvalidURL)
+		switch {
+		case errors.As(err, &invalidURLErr):
+			writeInvalidURL(w, invalidURLErr)
+		case errors.Is(err, errs.ErrInvalidUpdate), errors.Is(err, errs.ErrInvalidExpiry), errors.Is(err, errs.ErrInvalidTag):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, errs.ErrURLNotFound):
+			http.Error(w, "URL not found!", http.StatusNotFound)
+		case errors.Is(err, errs.ErrURLDeleted):
+			w.WriteHeader(http.StatusGone)
+		default:
+			if existingErr := new(errs.OriginalURLAlreadyExists); errors.As(err, &existingErr) {
+				http.Error(w, existingErr.Error(), http.StatusConflict)
+				return
+			}
+			middleware.LogFromContext(r.Context()).Errorw("update url failed", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := model.UpdateURLResponse{
+		ShortURL:     fmt.Sprintf("%s/%s", h.baseURL.String(), url.ID),
+		OriginalURL:  url.OriginalURL,
+		CanonicalURL: url.CanonicalURL,
+		ExpiresAt:    url.ExpiresAt,
+		Tags:         url.Tags,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("error to create response", "error", err)
+		return
+	}
+}
+
+func writeInvalidURL(w http.ResponseWriter, err *errs.InvalidURL) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(model.InvalidURLResponse{Error: err.Reason, Rule: err.Rule, URL: err.URL})
 }
@@ -1,19 +1,27 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
 	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
 	"github.com/pervukhinpm/link-shortener.git/internal/service"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateShortenerURL(t *testing.T) {
 	urlService := service.NewMockService()
 	baseURL := NewServerURL("http", "localhost", 8080)
-	h := NewHandler(urlService, *baseURL)
+	h := NewHandler(urlService, service.NewMockStatsService(), *baseURL)
 
 	type want struct {
 		contentType string
@@ -97,19 +105,55 @@ func TestCreateShortenerURL(t *testing.T) {
 	}
 }
 
+func TestCreateShortenerURLErrors(t *testing.T) {
+	middleware.Initialize()
+	baseURL := NewServerURL("http", "localhost", 8080)
+
+	repo, err := repository.NewRAMRepository(repository.DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := service.NewURLValidator(service.URLValidationOptions{AllowedSchemes: []string{"http", "https"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	urlService := service.NewURLService(repo, service.NewSequentialGenerator(1), repository.DedupeGlobal, canonical.Options{}, validator)
+	h := NewHandler(urlService, service.NewMockStatsService(), *baseURL)
+
+	rr := httptest.NewRecorder()
+	h.CreateShortenerURL(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("javascript:alert(1)")))
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("invalid url: got %d %q, want 400 application/json", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if want := `{"error":"scheme must be one of: http, https","rule":"scheme","url":"javascript:alert(1)"}` + "\n"; rr.Body.String() != want {
+		t.Errorf("invalid url body = %q, want %q", rr.Body.String(), want)
+	}
+
+	failing := service.NewMockService()
+	failing.ShortenErr = errors.New("storage is down")
+	h = NewHandler(failing, service.NewMockStatsService(), *baseURL)
+	rr = httptest.NewRecorder()
+	h.CreateShortenerURL(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/")))
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "storage") {
+		t.Errorf("storage error: got %d %q, want bare 500", rr.Code, rr.Body.String())
+	}
+}
+
 func TestGetShortenerURL(t *testing.T) {
 	urlService := service.NewMockService()
 	baseURL := NewServerURL("http", "localhost", 8080)
-	h := NewHandler(urlService, *baseURL)
+	h := NewHandler(urlService, service.NewMockStatsService(), *baseURL)
 
 	type want struct {
 		statusCode int
 		location   string
 	}
+	expired := time.Now().Add(-time.Hour)
 	tests := []struct {
-		name    string
-		shortID string
-		want    want
+		name      string
+		shortID   string
+		expiresAt *time.Time
+		want      want
 	}{
 		{
 			name:    "positive test #1",
@@ -119,6 +163,15 @@ func TestGetShortenerURL(t *testing.T) {
 				location:   "https://practicum.yandex.ru/",
 			},
 		},
+		{
+			name:      "expired link",
+			shortID:   "expiredID",
+			expiresAt: &expired,
+			want: want{
+				statusCode: http.StatusGone,
+				location:   "",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -127,6 +180,7 @@ func TestGetShortenerURL(t *testing.T) {
 			testURL := &domain.URL{
 				ID:          tt.shortID,
 				OriginalURL: "https://practicum.yandex.ru/",
+				ExpiresAt:   tt.expiresAt,
 			}
 
 			if tt.shortID != "" {
@@ -156,7 +210,7 @@ func TestGetShortenerURL(t *testing.T) {
 func TestCreateJSONShortenerURL(t *testing.T) {
 	urlService := service.NewMockService()
 	baseURL := NewServerURL("http", "localhost", 8080)
-	h := NewHandler(urlService, *baseURL)
+	h := NewHandler(urlService, service.NewMockStatsService(), *baseURL)
 
 	type want struct {
 		contentType string
@@ -167,6 +221,7 @@ func TestCreateJSONShortenerURL(t *testing.T) {
 		name        string
 		requestBody string
 		shortURL    string
+		shortenErr  error
 		contentType string
 		want        want
 	}{
@@ -211,6 +266,39 @@ func TestCreateJSONShortenerURL(t *testing.T) {
 				response:    "unexpected end of JSON input\n",
 			},
 		},
+		{
+			name:        "alias already taken",
+			requestBody: `{"url": "https://practicum.yandex.ru/", "alias": "spring-sale"}`,
+			shortenErr:  errs.NewShortURLAlreadyExists("spring-sale"),
+			contentType: "application/json",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusConflict,
+				response:    "short URL already exists: spring-sale\n",
+			},
+		},
+		{
+			name:        "invalid alias",
+			requestBody: `{"url": "https://practicum.yandex.ru/", "alias": "api"}`,
+			shortenErr:  errs.NewInvalidAlias("api", "alias is reserved"),
+			contentType: "application/json",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusBadRequest,
+				response:    "invalid alias \"api\": alias is reserved\n",
+			},
+		},
+		{
+			name:        "private host",
+			requestBody: `{"url": "http://127.0.0.1/admin"}`,
+			shortenErr:  errs.NewInvalidURL("http://127.0.0.1/admin", errs.URLRulePrivateHost, "host \"127.0.0.1\" is a private or loopback address"),
+			contentType: "application/json",
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusBadRequest,
+				response:    `{"error":"host \"127.0.0.1\" is a private or loopback address","rule":"private_host","url":"http://127.0.0.1/admin"}` + "\n",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -221,6 +309,7 @@ func TestCreateJSONShortenerURL(t *testing.T) {
 			if tt.shortURL != "" {
 				urlService.ShortenURL = testURL
 			}
+			urlService.ShortenErr = tt.shortenErr
 
 			req, err := http.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.requestBody))
 			if err != nil {
@@ -248,3 +337,82 @@ func TestCreateJSONShortenerURL(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUserURL(t *testing.T) {
+	middleware.Initialize()
+	urlService := service.NewMockService()
+	h := NewHandler(urlService, service.NewMockStatsService(), *NewServerURL("http", "localhost", 8080))
+
+	tests := []struct {
+		name        string
+		body        string
+		updateErr   error
+		statusCode  int
+		response    string
+		wantOptions func(options service.UpdateOptions) bool
+	}{
+		{
+			name:       "change url",
+			body:       `{"original_url": "https://new.example/"}`,
+			statusCode: http.StatusOK,
+			response:   `{"short_url":"http://localhost:8080/abc","original_url":"https://new.example/"}` + "\n",
+			wantOptions: func(options service.UpdateOptions) bool {
+				return options.OriginalURL != nil && !options.ClearExpiry && options.ExpiresAt == nil
+			},
+		},
+		{
+			name:        "clear expiry",
+			body:        `{"expires_at": null}`,
+			statusCode:  http.StatusOK,
+			wantOptions: func(options service.UpdateOptions) bool { return options.ClearExpiry && options.ExpiresAt == nil },
+		},
+		{
+			name:        "set expiry",
+			body:        `{"expires_at": "2030-01-02T00:00:00Z"}`,
+			statusCode:  http.StatusOK,
+			wantOptions: func(options service.UpdateOptions) bool { return !options.ClearExpiry && options.ExpiresAt != nil },
+		},
+		{
+			name:        "replace tags with empty list",
+			body:        `{"tags": []}`,
+			statusCode:  http.StatusOK,
+			wantOptions: func(options service.UpdateOptions) bool { return options.Tags != nil && len(*options.Tags) == 0 },
+		},
+		{name: "nothing to update", body: `{}`, updateErr: errs.ErrInvalidUpdate, statusCode: http.StatusBadRequest, response: "invalid url update\n"},
+		{name: "not found or not owned", body: `{"ttl": 60}`, updateErr: errs.ErrURLNotFound, statusCode: http.StatusNotFound, response: "URL not found!\n"},
+		{name: "deleted", body: `{"ttl": 60}`, updateErr: errs.ErrURLDeleted, statusCode: http.StatusGone},
+		{
+			name:       "duplicate url",
+			body:       `{"original_url": "https://taken.example/"}`,
+			updateErr:  errs.NewOriginalURLAlreadyExists(domain.NewURL("taken", "https://taken.example/", "user", false)),
+			statusCode: http.StatusConflict,
+		},
+		{name: "malformed expires_at", body: `{"expires_at": "tomorrow"}`, statusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urlService.ShortenURL = &domain.URL{ID: "abc", OriginalURL: "https://old.example/"}
+			urlService.UpdateErr = tt.updateErr
+			urlService.LastUpdate = service.UpdateOptions{}
+
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "abc")
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/abc", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			rr := httptest.NewRecorder()
+			h.UpdateUserURL(rr, req)
+
+			if rr.Code != tt.statusCode {
+				t.Errorf("status = %d, want %d (%s)", rr.Code, tt.statusCode, rr.Body.String())
+			}
+			if tt.response != "" && rr.Body.String() != tt.response {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.response)
+			}
+			if tt.wantOptions != nil && !tt.wantOptions(urlService.LastUpdate) {
+				t.Errorf("service got options %+v", urlService.LastUpdate)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"net/http"
+)
+
+type StatsHandler struct {
+	statsService service.StatsServiceReader
+	baseURL      ServerURL
+}
+
+func NewStatsHandler(statsService service.StatsServiceReader, baseURL ServerURL) *StatsHandler {
+	return &StatsHandler{
+		statsService: statsService,
+		baseURL:      baseURL,
+	}
+}
+
+func (h *StatsHandler) GetURLStats(w http.ResponseWriter, r *http.Request) {
+	shortID := chi.URLParam(r, "id")
+
+	stats, err := h.statsService.GetStats(r.Context(), shortID)
+	if err != nil {
+		if errors.Is(err, errs.ErrURLNotFound) {
+			http.Error(w, "URL not found!", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, errs.ErrNotURLOwner) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errs.ErrURLDeleted) {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		middleware.LogFromContext(r.Context()).Errorw("error to get url stats", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := model.ClickStatsResponse{
+		ShortURL:       fmt.Sprintf("%s/%s", h.baseURL.String(), stats.ShortURL),
+		TotalClicks:    stats.TotalClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+		Daily:          make([]model.DailyClicksResponseItem, 0, len(stats.Daily)),
+	}
+	for _, daily := range stats.Daily {
+		response.Daily = append(response.Daily, model.DailyClicksResponseItem{
+			Date:   daily.Day.Format("2006-01-02"),
+			Clicks: daily.Clicks,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("error to create response", "error", err)
+		return
+	}
+}
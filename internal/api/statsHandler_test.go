@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetURLStats(t *testing.T) {
+	middleware.Initialize()
+	statsService := service.NewMockStatsService()
+	h := NewStatsHandler(statsService, *NewServerURL("http", "localhost", 8080))
+
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		stats      *domain.ClickStats
+		err        error
+		statusCode int
+		response   string
+	}{
+		{
+			name: "owner",
+			stats: &domain.ClickStats{
+				ShortURL:       "abc",
+				TotalClicks:    3,
+				UniqueVisitors: 2,
+				Daily:          []domain.DailyClicks{{Day: day, Clicks: 3}},
+			},
+			statusCode: http.StatusOK,
+			response:   `{"short_url":"http://localhost:8080/abc","total_clicks":3,"unique_visitors":2,"daily":[{"date":"2026-01-02","clicks":3}]}` + "\n",
+		},
+		{
+			name:       "no clicks",
+			stats:      &domain.ClickStats{ShortURL: "abc"},
+			statusCode: http.StatusOK,
+			response:   `{"short_url":"http://localhost:8080/abc","total_clicks":0,"unique_visitors":0,"daily":[]}` + "\n",
+		},
+		{name: "unknown link", err: errs.ErrURLNotFound, statusCode: http.StatusNotFound, response: "URL not found!\n"},
+		{name: "other user's link", err: errs.ErrNotURLOwner, statusCode: http.StatusForbidden},
+		{name: "deleted link", err: errs.ErrURLDeleted, statusCode: http.StatusGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statsService.Stats, statsService.Err = tt.stats, tt.err
+
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "abc")
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/abc/stats", nil)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			rr := httptest.NewRecorder()
+			h.GetURLStats(rr, req)
+
+			if rr.Code != tt.statusCode {
+				t.Errorf("status = %d, want %d", rr.Code, tt.statusCode)
+			}
+			if rr.Body.String() != tt.response {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.response)
+			}
+		})
+	}
+}
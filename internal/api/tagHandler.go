@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/service"
+	"net/http"
+	"strings"
+)
+
+type TagHandler struct {
+	tagService service.TagServiceManager
+}
+
+func NewTagHandler(tagService service.TagServiceManager) *TagHandler {
+	return &TagHandler{tagService: tagService}
+}
+
+func (h *TagHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.tagService.ListTags(r.Context())
+	if err != nil {
+		middleware.LogFromContext(r.Context()).Errorw("failed to list tags", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]model.TagResponseItem, len(tags))
+	for i, tag := range tags {
+		response[i] = model.TagResponseItem{Name: tag.Name, Count: tag.Count}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *TagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	var renameBody model.RenameTagBody
+	if !decodeJSONBody(w, r, &renameBody) {
+		return
+	}
+
+	err := h.tagService.RenameTag(r.Context(), chi.URLParam(r, "name"), renameBody.Name)
+	h.writeMergeResult(w, r, err)
+}
+
+func (h *TagHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	var mergeBody model.MergeTagsBody
+	if !decodeJSONBody(w, r, &mergeBody) {
+		return
+	}
+
+	err := h.tagService.MergeTags(r.Context(), mergeBody.Sources, mergeBody.Target)
+	h.writeMergeResult(w, r, err)
+}
+
+func (h *TagHandler) writeMergeResult(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errs.ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errs.ErrTagNotFound):
+		http.Error(w, "Tag not found!", http.StatusNotFound)
+	default:
+		middleware.LogFromContext(r.Context()).Errorw("failed to merge tags", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Only application/json supported Media Type!", http.StatusBadRequest)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+// Package canonical приводит URL к каноническому виду, чтобы разные записи
+// одного адреса давали одну короткую ссылку.
+package canonical
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type Options struct {
+	// SortQuery сортирует параметры запроса по имени; порядок одноимённых параметров сохраняется.
+	SortQuery bool
+	// StripTracking удаляет параметры отслеживания: utm_* и идентификаторы кликов рекламных сетей.
+	StripTracking bool
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+var trackingParams = map[string]bool{
+	"fbclid": true,
+	"gclid":  true,
+	"yclid":  true,
+}
+
+// Canonicalize приводит схему и хост к нижнему регистру, IDN — к punycode, убирает порт
+// по умолчанию и нормализует percent-encoding. URL без хоста возвращается как есть.
+func Canonicalize(raw string, options Options) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return raw, nil
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, err := canonicalHost(u)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(host)
+
+	path := normalizeEscapes(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := canonicalQuery(u.RawQuery, options); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+	if fragment := normalizeEscapes(u.EscapedFragment()); fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(fragment)
+	}
+	return b.String(), nil
+}
+
+// canonicalHost берёт хост и порт через Hostname/Port: они снимают скобки с IPv6
+// и с портом, и без него.
+func canonicalHost(u *url.URL) (string, error) {
+	host, port := u.Hostname(), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if net.ParseIP(host) != nil {
+		host = strings.ToLower(host)
+	} else {
+		var err error
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return "", fmt.Errorf("invalid host %q: %w", u.Host, err)
+		}
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		return host + ":" + port, nil
+	}
+	return host, nil
+}
+
+func canonicalQuery(rawQuery string, options Options) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		part = normalizeEscapes(part)
+		name, _, _ := strings.Cut(part, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if options.StripTracking && isTrackingParam(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: part})
+	}
+	if options.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// normalizeEscapes декодирует экранированные незарезервированные символы (RFC 3986, 2.3)
+// и приводит шестнадцатеричные цифры остальных к верхнему регистру.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,77 @@
+package canonical
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	all := Options{SortQuery: true, StripTracking: true}
+
+	tests := []struct {
+		name    string
+		raw     string
+		options Options
+		want    string
+	}{
+		{name: "scheme and host case", raw: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "default http port", raw: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "default https port", raw: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "non default port", raw: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "empty path", raw: "https://example.com", want: "https://example.com/"},
+		{name: "idn host", raw: "https://пример.рф/", want: "https://xn--e1afmkfd.xn--p1ai/"},
+		{name: "punycode host", raw: "https://XN--E1AFMKFD.xn--p1ai/", want: "https://xn--e1afmkfd.xn--p1ai/"},
+		{name: "ipv6 host", raw: "http://[2001:DB8::1]:80/", want: "http://[2001:db8::1]/"},
+		{name: "ipv6 host without port", raw: "http://[2001:DB8::1]/a", want: "http://[2001:db8::1]/a"},
+		{name: "ipv6 loopback without port", raw: "http://[::1]/a", want: "http://[::1]/a"},
+		{name: "ipv6 non default port", raw: "https://[::1]:8443/a", want: "https://[::1]:8443/a"},
+		{name: "empty port", raw: "http://example.com:/a", want: "http://example.com/a"},
+		{name: "unreserved escapes decoded", raw: "https://example.com/%7euser/%41", want: "https://example.com/~user/A"},
+		{name: "reserved escapes uppercased", raw: "https://example.com/a%2fb?q=a%2bb", want: "https://example.com/a%2Fb?q=a%2Bb"},
+		{name: "unicode path", raw: "https://example.com/привет", want: "https://example.com/%D0%BF%D1%80%D0%B8%D0%B2%D0%B5%D1%82"},
+		{name: "query order kept by default", raw: "http://example.com/a?b=1&a=2", want: "http://example.com/a?b=1&a=2"},
+		{name: "query sorted", raw: "http://Example.com/a?b=1&a=2", options: all, want: "http://example.com/a?a=2&b=1"},
+		{name: "same name order kept", raw: "http://example.com/?b=2&a=1&b=1", options: all, want: "http://example.com/?a=1&b=2&b=1"},
+		{
+			name:    "tracking stripped",
+			raw:     "https://example.com/?utm_source=x&id=1&UTM_Campaign=y&fbclid=z",
+			options: all,
+			want:    "https://example.com/?id=1",
+		},
+		{name: "tracking kept without option", raw: "https://example.com/?utm_source=x", want: "https://example.com/?utm_source=x"},
+		{name: "only tracking params", raw: "https://example.com/a?utm_source=x", options: all, want: "https://example.com/a"},
+		{name: "fragment kept", raw: "https://example.com/a#Top", want: "https://example.com/a#Top"},
+		{name: "no host", raw: "mailto:User@Example.com", want: "mailto:User@Example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.raw, tt.options)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) error = %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeSameLink(t *testing.T) {
+	options := Options{SortQuery: true, StripTracking: true}
+	first, err := Canonicalize("http://Example.com/a?b=1&a=2", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Canonicalize("http://example.com:80/a?a=2&b=1", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("canonical forms differ: %q and %q", first, second)
+	}
+}
+
+func TestCanonicalizeInvalid(t *testing.T) {
+	for _, raw := range []string{"http://exa mple.com/", "http://[::1/", "https://xn--a.com/"} {
+		if got, err := Canonicalize(raw, Options{}); err == nil {
+			t.Errorf("Canonicalize(%q) = %q, want error", raw, got)
+		}
+	}
+}
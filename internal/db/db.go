@@ -9,7 +9,7 @@ import (
 func NewDB(dsn string) (*pgxpool.Pool, error) {
 	pool, err := pgxpool.New(context.Background(), dsn)
 	if err != nil {
-		middleware.Log.Error("Failed to connect to database: %v", err)
+		middleware.Log.Errorw("Failed to connect to database", "error", err)
 		return nil, err
 	}
 	return pool, nil
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID — ключ advisory lock, под которым реплики по очереди применяют миграции.
+const migrationLockID int64 = 7_240_151_337
+
+var ErrNoMigrationsToRollback = errors.New("no applied migrations to roll back")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := LoadMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// LoadMigrations читает пары файлов вида 0001_name.up.sql / 0001_name.down.sql.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+
+		versionPart, name, found := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>", base)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", base, versionPart)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up применяет все ещё не применённые миграции и возвращает их список.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		appliedVersions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := appliedVersions[migration.Version]; ok {
+				continue
+			}
+			err := runInTx(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3);",
+				migration.Version, migration.Name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			middleware.Log.Infow("Applied migration", "version", migration.Version, "name", migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних применённых миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		appliedVersions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(appliedVersions) == 0 {
+			return ErrNoMigrationsToRollback
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := appliedVersions[migration.Version]; !ok {
+				continue
+			}
+			err := runInTx(ctx, conn, migration.Down,
+				"DELETE FROM schema_migrations WHERE version = $1;", migration.Version)
+			if err != nil {
+				return fmt.Errorf("roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			middleware.Log.Infow("Rolled back migration", "version", migration.Version, "name", migration.Name)
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status возвращает все известные миграции с отметкой о применении.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	appliedVersions, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := appliedVersions[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// withLock выполняет fn на одном соединении под сессионным advisory lock,
+// чтобы несколько одновременно стартующих реплик не применяли миграции параллельно.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1);", migrationLockID); err != nil {
+		return err
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1);", migrationLockID)
+		if err != nil {
+			middleware.Log.Errorw("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL PRIMARY KEY,
+		name varchar NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	);`
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[int]time.Time)
+	var version int
+	var appliedAt time.Time
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		versions[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// runInTx выполняет SQL миграции и запись в schema_migrations атомарно.
+func runInTx(ctx context.Context, conn *pgxpool.Conn, migrationSQL string, bookkeeping string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Без аргументов pgx использует простой протокол, поэтому файл может содержать несколько команд
+	if _, err := tx.Exec(ctx, migrationSQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
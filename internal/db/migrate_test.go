@@ -0,0 +1,31 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationsFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+	}
+}
+
+func TestLoadMigrationsRequiresDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0001_create_urls.up.sql": {Data: []byte("CREATE TABLE urls ();")},
+	}
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Fatal("expected error for migration without down file")
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS urls (
+	uuid varchar NOT NULL PRIMARY KEY,
+	short_url varchar NOT NULL UNIQUE,
+	original_url varchar NOT NULL UNIQUE,
+	user_id varchar NOT NULL,
+	is_deleted BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS delete_job_items;
+DROP TABLE IF EXISTS delete_jobs;
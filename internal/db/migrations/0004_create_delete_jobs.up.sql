@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS delete_jobs (
+	id varchar NOT NULL PRIMARY KEY,
+	user_id varchar NOT NULL,
+	status varchar NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error varchar NOT NULL DEFAULT '',
+	run_after TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS delete_jobs_active_idx ON delete_jobs (run_after) WHERE status IN ('pending', 'running');
+CREATE TABLE IF NOT EXISTS delete_job_items (
+	job_id varchar NOT NULL REFERENCES delete_jobs (id) ON DELETE CASCADE,
+	position integer NOT NULL,
+	short_url varchar NOT NULL,
+	status varchar NOT NULL,
+	PRIMARY KEY (job_id, position)
+);
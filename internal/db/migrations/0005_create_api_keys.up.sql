@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id varchar NOT NULL PRIMARY KEY,
+	user_id varchar NOT NULL,
+	name varchar NOT NULL,
+	key_hash varchar NOT NULL UNIQUE,
+	prefix varchar NOT NULL,
+	scopes varchar[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
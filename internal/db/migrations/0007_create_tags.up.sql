@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS tags (
+	id BIGSERIAL PRIMARY KEY,
+	user_id varchar NOT NULL,
+	name varchar NOT NULL,
+	UNIQUE (user_id, name)
+);
+CREATE TABLE IF NOT EXISTS url_tags (
+	short_url varchar NOT NULL REFERENCES urls (short_url) ON DELETE CASCADE,
+	tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	PRIMARY KEY (short_url, tag_id)
+);
+CREATE INDEX IF NOT EXISTS url_tags_tag_id_idx ON url_tags (tag_id);
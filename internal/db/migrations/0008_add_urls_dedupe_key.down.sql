@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_dedupe_key_key;
+ALTER TABLE urls DROP COLUMN IF EXISTS dedupe_key;
+ALTER TABLE urls ADD CONSTRAINT urls_original_url_key UNIQUE (original_url);
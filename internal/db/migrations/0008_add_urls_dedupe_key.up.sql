@@ -0,0 +1,4 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedupe_key varchar;
+UPDATE urls SET dedupe_key = original_url WHERE dedupe_key IS NULL;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_dedupe_key_key ON urls (dedupe_key);
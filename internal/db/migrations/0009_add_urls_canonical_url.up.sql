@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical_url varchar NOT NULL DEFAULT '';
+UPDATE urls SET canonical_url = original_url WHERE canonical_url = '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS urls_dedupe_key_key;
+CREATE UNIQUE INDEX urls_dedupe_key_key ON urls (dedupe_key) WHERE NOT is_deleted;
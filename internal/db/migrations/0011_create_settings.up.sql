@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS settings (
+	name varchar PRIMARY KEY,
+	value varchar NOT NULL
+);
@@ -0,0 +1,16 @@
+package errs
+
+import "fmt"
+
+type InvalidAlias struct {
+	Alias  string
+	Reason string
+}
+
+func NewInvalidAlias(alias, reason string) *InvalidAlias {
+	return &InvalidAlias{Alias: alias, Reason: reason}
+}
+
+func (e *InvalidAlias) Error() string {
+	return fmt.Sprintf("invalid alias %q: %s", e.Alias, e.Reason)
+}
@@ -0,0 +1,9 @@
+package errs
+
+import "errors"
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key revoked")
+	ErrInvalidAPIKey  = errors.New("invalid api key request")
+)
@@ -0,0 +1,8 @@
+package errs
+
+import "errors"
+
+var (
+	ErrEmptyURL               = errors.New("empty original url")
+	ErrDuplicateCorrelationID = errors.New("duplicate correlation_id in batch")
+)
@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrURLDeleted = errors.New("shortened URL is deleted")
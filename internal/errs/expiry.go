@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrInvalidExpiry = errors.New("invalid link expiration")
@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrNotURLOwner = errors.New("url belongs to another user")
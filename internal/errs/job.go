@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrJobNotFound = errors.New("delete job not found")
@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrInvalidPage = errors.New("invalid page request")
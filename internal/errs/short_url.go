@@ -0,0 +1,15 @@
+package errs
+
+import "fmt"
+
+type ShortURLAlreadyExists struct {
+	ID string
+}
+
+func NewShortURLAlreadyExists(id string) *ShortURLAlreadyExists {
+	return &ShortURLAlreadyExists{ID: id}
+}
+
+func (e *ShortURLAlreadyExists) Error() string {
+	return fmt.Sprintf("short URL already exists: %s", e.ID)
+}
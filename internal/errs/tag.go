@@ -0,0 +1,8 @@
+package errs
+
+import "errors"
+
+var (
+	ErrInvalidTag  = errors.New("invalid tag")
+	ErrTagNotFound = errors.New("tag not found")
+)
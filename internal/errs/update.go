@@ -0,0 +1,5 @@
+package errs
+
+import "errors"
+
+var ErrInvalidUpdate = errors.New("invalid url update")
@@ -0,0 +1,37 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidURL = errors.New("invalid url")
+
+// Правила, которые может нарушить сокращаемый URL.
+const (
+	URLRuleMalformed       = "malformed"
+	URLRuleLength          = "length"
+	URLRuleScheme          = "scheme"
+	URLRulePrivateHost     = "private_host"
+	URLRuleSelfReference   = "self_reference"
+	URLRuleNestedShortener = "nested_shortener"
+)
+
+// InvalidURL описывает нарушенное правило; errors.Is(err, ErrInvalidURL) для него истинно.
+type InvalidURL struct {
+	URL    string
+	Rule   string
+	Reason string
+}
+
+func NewInvalidURL(url, rule, reason string) *InvalidURL {
+	return &InvalidURL{URL: url, Rule: rule, Reason: reason}
+}
+
+func (e *InvalidURL) Error() string {
+	return fmt.Sprintf("invalid url: %s", e.Reason)
+}
+
+func (e *InvalidURL) Is(target error) bool {
+	return target == ErrInvalidURL
+}
@@ -1,9 +1,9 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/google/uuid"
 	"time"
 )
 
@@ -12,21 +12,58 @@ type Claims struct {
 	UserID string
 }
 
-const (
-	TokenExp  = time.Hour * 3
-	SecretKey = "secret_key"
-)
+const DefaultTokenExp = time.Hour * 3
+
+// Manager подписывает токены активным ключом и проверяет их любым из известных ключей,
+// поэтому после ротации ранее выданные куки остаются валидными до истечения срока.
+type Manager struct {
+	keys     map[string]*Key
+	active   *Key
+	tokenExp time.Duration
+}
+
+func NewManager(keySet *KeySet, tokenExp time.Duration) (*Manager, error) {
+	if len(keySet.Keys) == 0 {
+		return nil, errors.New("jwt: at least one key is required")
+	}
+
+	keys := make(map[string]*Key, len(keySet.Keys))
+	for _, key := range keySet.Keys {
+		if _, duplicate := keys[key.ID]; duplicate {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	active, ok := keys[keySet.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: active key %q not found", keySet.ActiveKeyID)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("jwt: active key %q has no private key", keySet.ActiveKeyID)
+	}
+
+	if tokenExp <= 0 {
+		tokenExp = DefaultTokenExp
+	}
+
+	return &Manager{keys: keys, active: active, tokenExp: tokenExp}, nil
+}
+
+func (m *Manager) TokenExp() time.Duration {
+	return m.tokenExp
+}
 
-func BuildJWTString() (string, error) {
-	userID := uuid.NewString()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+func (m *Manager) BuildJWTStringForUser(userID string) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.tokenExp)),
 		},
 		UserID: userID,
 	})
+	token.Header["kid"] = m.active.ID
 
-	tokenString, err := token.SignedString([]byte(SecretKey))
+	tokenString, err := token.SignedString(m.active.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -34,14 +71,9 @@ func BuildJWTString() (string, error) {
 	return tokenString, nil
 }
 
-func GetUserID(tokenString string) (string, error) {
+func (m *Manager) GetUserID(tokenString string) (string, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signed method: %v", t.Header["alg"])
-		}
-		return []byte(SecretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc)
 	if err != nil {
 		return "", err
 	}
@@ -50,3 +82,46 @@ func GetUserID(tokenString string) (string, error) {
 	}
 	return claims.UserID, nil
 }
+
+type TokenInfo struct {
+	UserID    string
+	ExpiresAt time.Time
+	Expired   bool
+}
+
+// ParseToken в отличие от GetUserID не считает ошибкой истёкший срок действия:
+// подпись проверяется всегда, а решение о продлении сессии остаётся за вызывающим.
+func (m *Manager) ParseToken(tokenString string) (*TokenInfo, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, m.keyFunc)
+
+	var validationErr *jwt.ValidationError
+	expiredOnly := errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired
+	if err != nil && !expiredOnly {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiration")
+	}
+
+	return &TokenInfo{
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Expired:   expiredOnly,
+	}, nil
+}
+
+func (m *Manager) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no key id")
+	}
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signed method: %v", t.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
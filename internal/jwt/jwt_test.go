@@ -0,0 +1,114 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v4"
+	"testing"
+	"time"
+)
+
+func privateKeyPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestManagerAlgorithms(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		model KeyFileModel
+	}{
+		{name: "HS256", model: KeyFileModel{ID: "hs", Alg: AlgHS256, Secret: "top-secret"}},
+		{name: "EdDSA", model: KeyFileModel{ID: "ed", Alg: AlgEdDSA, PrivateKey: privateKeyPEM(t, edKey)}},
+		{name: "ES256", model: KeyFileModel{ID: "es", Alg: AlgES256, PrivateKey: privateKeyPEM(t, ecKey)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := NewKey(tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := NewManager(&KeySet{ActiveKeyID: tt.model.ID, Keys: []*Key{key}}, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := m.BuildJWTStringForUser("user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, err := m.GetUserID(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userID != "user" {
+				t.Errorf("got user id %q, want %q", userID, "user")
+			}
+		})
+	}
+}
+
+func TestManagerRotation(t *testing.T) {
+	oldKey := NewHMACKey("old", []byte("old-secret"))
+	newKey := NewHMACKey("new", []byte("new-secret"))
+
+	before, err := NewManager(&KeySet{ActiveKeyID: "old", Keys: []*Key{oldKey}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.BuildJWTStringForUser("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewManager(&KeySet{ActiveKeyID: "new", Keys: []*Key{newKey, oldKey}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := after.GetUserID(oldToken); err != nil || userID != "user" {
+		t.Errorf("token signed with rotated key: got (%q, %v), want (%q, nil)", userID, err, "user")
+	}
+
+	withoutOld, err := NewManager(&KeySet{ActiveKeyID: "new", Keys: []*Key{newKey}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := withoutOld.GetUserID(oldToken); err == nil {
+		t.Error("token signed with removed key must be rejected")
+	}
+}
+
+func TestManagerRejectsForgedToken(t *testing.T) {
+	m, err := NewManager(&KeySet{ActiveKeyID: "k", Keys: []*Key{NewHMACKey("k", []byte("server-secret"))}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: "victim"})
+	forged.Header["kid"] = "k"
+	forgedString, err := forged.SignedString([]byte("secret_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.GetUserID(forgedString); err == nil {
+		t.Error("token signed with unknown secret must be rejected")
+	}
+}
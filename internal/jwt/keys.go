@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"os"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+)
+
+type Key struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+type KeySet struct {
+	ActiveKeyID string
+	Keys        []*Key
+}
+
+// KeyFileModel описывает ключ в JSON файле ключей. Для HS256 задаётся secret,
+// для EdDSA и ES256 — private_key в PEM, либо только public_key для ключей,
+// которыми уже не подписывают, но ещё проверяют выданные токены.
+type KeyFileModel struct {
+	ID         string `json:"kid"`
+	Alg        string `json:"alg"`
+	Secret     string `json:"secret,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+}
+
+type KeySetFileModel struct {
+	ActiveKeyID string         `json:"active_kid"`
+	Keys        []KeyFileModel `json:"keys"`
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func NewKey(model KeyFileModel) (*Key, error) {
+	if model.ID == "" {
+		return nil, fmt.Errorf("jwt: key id is required")
+	}
+
+	switch model.Alg {
+	case AlgHS256:
+		if model.Secret == "" {
+			return nil, fmt.Errorf("jwt: key %q: secret is required for %s", model.ID, model.Alg)
+		}
+		return NewHMACKey(model.ID, []byte(model.Secret)), nil
+	case AlgEdDSA:
+		key := &Key{ID: model.ID, method: jwt.SigningMethodEdDSA}
+		if model.PrivateKey != "" {
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM([]byte(model.PrivateKey))
+			if err != nil {
+				return nil, fmt.Errorf("jwt: key %q: %w", model.ID, err)
+			}
+			edPrivateKey, ok := privateKey.(ed25519.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("jwt: key %q: not an ed25519 private key", model.ID)
+			}
+			key.signKey = edPrivateKey
+			key.verifyKey = edPrivateKey.Public()
+			return key, nil
+		}
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM([]byte(model.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", model.ID, err)
+		}
+		key.verifyKey = publicKey
+		return key, nil
+	case AlgES256:
+		key := &Key{ID: model.ID, method: jwt.SigningMethodES256}
+		if model.PrivateKey != "" {
+			privateKey, err := jwt.ParseECPrivateKeyFromPEM([]byte(model.PrivateKey))
+			if err != nil {
+				return nil, fmt.Errorf("jwt: key %q: %w", model.ID, err)
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+			return key, nil
+		}
+		publicKey, err := jwt.ParseECPublicKeyFromPEM([]byte(model.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", model.ID, err)
+		}
+		key.verifyKey = publicKey
+		return key, nil
+	default:
+		return nil, fmt.Errorf("jwt: key %q: unsupported algorithm %q", model.ID, model.Alg)
+	}
+}
+
+func LoadKeySetFile(fileName string) (*KeySet, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var model KeySetFileModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("jwt: invalid keys file: %w", err)
+	}
+
+	keySet := &KeySet{ActiveKeyID: model.ActiveKeyID}
+	for _, keyModel := range model.Keys {
+		key, err := NewKey(keyModel)
+		if err != nil {
+			return nil, err
+		}
+		keySet.Keys = append(keySet.Keys, key)
+	}
+	return keySet, nil
+}
+
+// NewRandomKeySet создаёт одноразовый HS256 ключ. Токены, подписанные им,
+// перестают проверяться после рестарта, поэтому он подходит только для разработки.
+func NewRandomKeySet() (*KeySet, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &KeySet{
+		ActiveKeyID: "ephemeral",
+		Keys:        []*Key{NewHMACKey("ephemeral", secret)},
+	}, nil
+}
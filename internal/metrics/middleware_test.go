@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	for _, path := range []string{"/abc", "/def", "/missing/path"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues("/{id}", http.MethodGet, "307")); got != 2 {
+		t.Errorf("requests for /{id} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(HTTPRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
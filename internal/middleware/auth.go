@@ -2,55 +2,176 @@ package middleware
 
 import (
 	"context"
+	"github.com/google/uuid"
+	"github.com/pervukhinpm/link-shortener.git/domain"
 	"github.com/pervukhinpm/link-shortener.git/internal/jwt"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const CookieName = "jwt"
 
-func Auth(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, r *http.Request) {
-			var tokenString string
+type AuthOptions struct {
+	// SecureCookie выставляет атрибут Secure, включать при работе за HTTPS.
+	SecureCookie bool
+	// RefreshBefore — за сколько до истечения токена выдавать новую куку.
+	RefreshBefore time.Duration
+	// ExpiredGrace — сколько после истечения токена ещё можно продлить сессию того же пользователя.
+	// Держать коротким: в пределах окна истёкший токен работает как действующий. 0 — не продлевать.
+	ExpiredGrace time.Duration
+}
 
-			cookie, err := r.Cookie(CookieName)
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, rawKey string) (*domain.APIKey, error)
+}
 
-			if err != nil {
-				tokenString, err = jwt.BuildJWTString()
-
-				if err != nil {
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
-
-				http.SetCookie(w, &http.Cookie{
-					Name:  CookieName,
-					Value: tokenString,
-				})
-			} else {
-				tokenString = cookie.Value
-			}
+type Authenticator struct {
+	tokens  *jwt.Manager
+	apiKeys APIKeyResolver
+	options AuthOptions
+}
 
-			userID, err := jwt.GetUserID(tokenString)
+func NewAuthenticator(tokens *jwt.Manager, apiKeys APIKeyResolver, options AuthOptions) *Authenticator {
+	return &Authenticator{tokens: tokens, apiKeys: apiKeys, options: options}
+}
 
+func (a *Authenticator) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rawKey := apiKeyFromRequest(r); rawKey != "" {
+			key, err := a.apiKeys.ResolveAPIKey(r.Context(), rawKey)
 			if err != nil {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+			ctx := setUserID(r.Context(), key.UserID)
+			ctx = setAPIKey(ctx, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
-			ctx := setUserID(r.Context(), userID)
+		userID, err := a.authenticate(w, r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+		ctx := setUserID(r.Context(), userID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate возвращает пользователя из куки и при необходимости выдаёт новую куку:
+// продлевает сессию, если токен скоро истечёт или истёк недавно, и заводит нового
+// пользователя, если куки нет или она не прошла проверку подписи.
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) (string, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return a.issueNewUser(w)
+	}
+
+	info, err := a.tokens.ParseToken(cookie.Value)
+	if err != nil {
+		LogFromContext(r.Context()).Infow("invalid auth token, issuing new one", "error", err)
+		return a.issueNewUser(w)
+	}
+
+	now := time.Now()
+	if info.Expired && now.Sub(info.ExpiresAt) > a.options.ExpiredGrace {
+		return a.issueNewUser(w)
+	}
+
+	if info.Expired || info.ExpiresAt.Sub(now) < a.options.RefreshBefore {
+		tokenString, err := a.tokens.BuildJWTStringForUser(info.UserID)
+		if err != nil {
+			return "", err
 		}
-		return http.HandlerFunc(fn)
-	}(next)
+		a.setCookie(w, tokenString)
+	}
+
+	return info.UserID, nil
+}
+
+func (a *Authenticator) issueNewUser(w http.ResponseWriter) (string, error) {
+	userID := uuid.NewString()
+	tokenString, err := a.tokens.BuildJWTStringForUser(userID)
+	if err != nil {
+		return "", err
+	}
+
+	a.setCookie(w, tokenString)
+	return userID, nil
+}
+
+func (a *Authenticator) setCookie(w http.ResponseWriter, tokenString string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    tokenString,
+		Path:     "/",
+		MaxAge:   int(a.tokens.TokenExp().Seconds()),
+		HttpOnly: true,
+		Secure:   a.options.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RequireScope ограничивает доступ для запросов с API ключом, у которого нет нужного скоупа.
+// Запросы с сессионной кукой проходят без ограничений.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := GetAPIKey(r.Context()); key != nil && !key.HasScope(scope) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession запрещает запросы с API ключом, например чтобы ключом нельзя было выпустить новый ключ.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKey(r.Context()) != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+type apiKeyContextKey struct{}
+
+func setAPIKey(ctx context.Context, key *domain.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+func GetAPIKey(ctx context.Context) *domain.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*domain.APIKey)
+	return key
 }
 
 type UserID struct {
 	value string
 }
 
+// setUserID также дописывает пользователя в логгер запроса и строку access-лога.
 func setUserID(ctx context.Context, userID string) context.Context {
+	if entry, ok := ctx.Value(accessEntryContextKey{}).(*accessEntry); ok {
+		entry.userID = userID
+	}
+	ctx = WithLogger(ctx, LogFromContext(ctx).With("user_id", userID))
 	return context.WithValue(ctx, UserID{}, userID)
 }
 
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/pervukhinpm/link-shortener.git/internal/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signedToken(t *testing.T, userID string, expiresAt time.Time) string {
+	t.Helper()
+	token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, jwt.Claims{
+		RegisteredClaims: gojwt.RegisteredClaims{ExpiresAt: gojwt.NewNumericDate(expiresAt)},
+		UserID:           userID,
+	})
+	token.Header["kid"] = "test"
+	tokenString, err := token.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString
+}
+
+func TestAuthSessionRenewal(t *testing.T) {
+	Initialize()
+
+	tokens, err := jwt.NewManager(&jwt.KeySet{
+		ActiveKeyID: "test",
+		Keys:        []*jwt.Key{jwt.NewHMACKey("test", []byte("test-secret"))},
+	}, 3*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := NewAuthenticator(tokens, nil, AuthOptions{
+		RefreshBefore: time.Hour,
+		ExpiredGrace:  24 * time.Hour,
+	})
+
+	now := time.Now()
+	tests := []struct {
+		name          string
+		cookie        string
+		wantSameUser  bool
+		wantNewCookie bool
+	}{
+		{name: "no cookie", cookie: "", wantSameUser: false, wantNewCookie: true},
+		{name: "fresh token", cookie: signedToken(t, "user", now.Add(2*time.Hour)), wantSameUser: true, wantNewCookie: false},
+		{name: "token close to expiry", cookie: signedToken(t, "user", now.Add(10*time.Minute)), wantSameUser: true, wantNewCookie: true},
+		{name: "recently expired token", cookie: signedToken(t, "user", now.Add(-time.Hour)), wantSameUser: true, wantNewCookie: true},
+		{name: "long expired token", cookie: signedToken(t, "user", now.Add(-48*time.Hour)), wantSameUser: false, wantNewCookie: true},
+		{name: "forged token", cookie: "not-a-jwt", wantSameUser: false, wantNewCookie: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID string
+			handler := authenticator.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID = GetUserID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rr.Code, http.StatusOK)
+			}
+			if (gotUserID == "user") != tt.wantSameUser {
+				t.Errorf("got user id %q, want same user: %v", gotUserID, tt.wantSameUser)
+			}
+
+			cookies := rr.Result().Cookies()
+			if (len(cookies) > 0) != tt.wantNewCookie {
+				t.Fatalf("got %d cookies, want new cookie: %v", len(cookies), tt.wantNewCookie)
+			}
+			if len(cookies) == 0 {
+				return
+			}
+
+			cookie := cookies[0]
+			if !cookie.HttpOnly || cookie.Path != "/" || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+				t.Errorf("cookie has unexpected attributes: %+v", cookie)
+			}
+			renewedUserID, err := tokens.GetUserID(cookie.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if renewedUserID != gotUserID {
+				t.Errorf("cookie user id %q differs from request user id %q", renewedUserID, gotUserID)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/http"
 	"time"
@@ -16,6 +19,37 @@ func Initialize() {
 	Log = zl.Sugar()
 }
 
+type loggerContextKey struct{}
+
+// WithLogger кладёт в контекст логгер с полями текущего запроса.
+func WithLogger(ctx context.Context, log *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+// LogFromContext возвращает логгер запроса, а вне запроса — глобальный логгер с trace_id
+// и span_id текущего спана, чтобы строки лога можно было сопоставить с трассой.
+func LogFromContext(ctx context.Context) *zap.SugaredLogger {
+	if log, ok := ctx.Value(loggerContextKey{}).(*zap.SugaredLogger); ok {
+		return log
+	}
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return Log
+	}
+	return Log.With(
+		"trace_id", spanContext.TraceID().String(),
+		"span_id", spanContext.SpanID().String(),
+	)
+}
+
+// accessEntry накапливает поля строки access-лога, которые становятся известны
+// глубже по цепочке middleware, например пользователь после аутентификации.
+type accessEntry struct {
+	userID string
+}
+
+type accessEntryContextKey struct{}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	responseStatus int
@@ -23,6 +57,9 @@ type loggingResponseWriter struct {
 }
 
 func (lrw *loggingResponseWriter) Write(data []byte) (int, error) {
+	if lrw.responseStatus == 0 {
+		lrw.responseStatus = http.StatusOK
+	}
 	size, err := lrw.ResponseWriter.Write(data)
 	lrw.responseSize += size
 	return size, err
@@ -33,24 +70,35 @@ func (lrw *loggingResponseWriter) WriteHeader(statusCode int) {
 	lrw.responseStatus = statusCode
 }
 
+// Logger пишет одну строку access-лога на запрос после его обработки.
 func Logger(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		Log.Infow(
-			"request",
-			"uri", r.RequestURI,
-			"method", r.Method,
-		)
-
+		entry := &accessEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), accessEntryContextKey{}, entry))
 		lrw := loggingResponseWriter{ResponseWriter: w}
 
 		start := time.Now()
 		h.ServeHTTP(&lrw, r) // Вызов метода ServeHTTP для хендлера
 		duration := time.Since(start)
 
-		Log.Infow(
-			"response",
-			"size", lrw.responseSize,
-			"status", lrw.responseStatus,
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		status := lrw.responseStatus
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		LogFromContext(r.Context()).Infow(
+			"access",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"route", route,
+			"user_id", entry.userID,
+			"remote_ip", GetClientIP(r),
+			"status", status,
+			"bytes", lrw.responseSize,
 			"duration", duration,
 		)
 	})
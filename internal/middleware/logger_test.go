@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zapcore.InfoLevel)
+	previous := Log
+	Log = zap.New(core).Sugar()
+	t.Cleanup(func() { Log = previous })
+	return logs
+}
+
+func TestLoggerWritesSingleAccessLine(t *testing.T) {
+	logs := observeLogs(t)
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(RequestID, resolver.Middleware, Logger)
+	r.With(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(setUserID(r.Context(), "user")))
+		})
+	}).Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		LogFromContext(r.Context()).Info("handler")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		w.Write([]byte("moved"))
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	request.RemoteAddr = "10.0.0.2:1234"
+	request.Header.Set(RequestIDHeader, "req-1")
+	request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	response := httptest.NewRecorder()
+	r.ServeHTTP(response, request)
+
+	if got := response.Header().Get(RequestIDHeader); got != "req-1" {
+		t.Errorf("%s = %q, want req-1", RequestIDHeader, got)
+	}
+
+	handlerLogs := logs.FilterMessage("handler").All()
+	if len(handlerLogs) != 1 {
+		t.Fatalf("handler log lines = %d, want 1", len(handlerLogs))
+	}
+	handlerFields := handlerLogs[0].ContextMap()
+	if handlerFields["request_id"] != "req-1" || handlerFields["user_id"] != "user" {
+		t.Errorf("handler log fields = %v", handlerFields)
+	}
+
+	accessLogs := logs.FilterMessage("access").All()
+	if len(accessLogs) != 1 || logs.Len() != 2 {
+		t.Fatalf("access log lines = %d of %d, want a single access line", len(accessLogs), logs.Len())
+	}
+	fields := accessLogs[0].ContextMap()
+	want := map[string]interface{}{
+		"request_id": "req-1",
+		"route":      "/{id}",
+		"user_id":    "user",
+		"remote_ip":  "203.0.113.7",
+		"status":     int64(http.StatusTemporaryRedirect),
+		"bytes":      int64(len("moved")),
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("access log %s = %v, want %v", key, fields[key], value)
+		}
+	}
+}
+
+func TestRequestIDReplacesInvalidHeader(t *testing.T) {
+	observeLogs(t)
+
+	var got string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetRequestID(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	if got == "" || got == "bad id\nwith newline" {
+		t.Fatalf("GetRequestID() = %q, want generated ID", got)
+	}
+	if response.Header().Get(RequestIDHeader) != got {
+		t.Errorf("response %s = %q, want %q", RequestIDHeader, response.Header().Get(RequestIDHeader), got)
+	}
+}
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "198.51.100.1:1000", want: "198.51.100.1"},
+		{name: "spoofed header from untrusted peer", remoteAddr: "198.51.100.1:1000", forwarded: "1.2.3.4", want: "198.51.100.1"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:1000", forwarded: "203.0.113.7", want: "203.0.113.7"},
+		{name: "proxy chain", remoteAddr: "192.168.1.1:1000", forwarded: "1.2.3.4, 203.0.113.7, 10.0.0.5", want: "203.0.113.7"},
+		{name: "only proxies", remoteAddr: "10.1.2.3:1000", forwarded: "10.0.0.9", want: "10.0.0.9"},
+		{name: "garbage header", remoteAddr: "10.1.2.3:1000", forwarded: "unknown", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := resolver.ClientIP(request); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewClientIPResolver([]string{"not-an-ip"}); err == nil {
+		t.Error("NewClientIPResolver() error = nil for invalid proxy")
+	}
+}
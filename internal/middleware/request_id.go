@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает чужой X-Request-ID, чтобы он не раздувал логи.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// RequestID берёт ID запроса из X-Request-ID или генерирует новый, возвращает его
+// в ответе и кладёт в контекст логгер, которым дальше пишут хендлеры, сервисы и хранилища.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, requestID)
+		ctx = WithLogger(ctx, LogFromContext(ctx).With("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
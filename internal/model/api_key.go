@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type CreateAPIKeyBody struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type APIKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Key возвращается только при создании, после этого сервер хранит лишь хеш.
+	Key string `json:"key,omitempty"`
+}
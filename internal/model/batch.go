@@ -1,19 +1,34 @@
 package model
 
+import "time"
+
 type BatchRequestBody struct {
 	BatchList []BatchRequestBodyItem
 }
 
 type BatchRequestBodyItem struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           int64      `json:"ttl,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
 }
 
 type BatchResponse struct {
 	BatchList []BatchResponseItem
 }
 
+// Статусы элементов ответа пакетного создания.
+const (
+	BatchItemCreated = "created"
+	BatchItemExisted = "existed"
+	BatchItemInvalid = "invalid"
+)
+
 type BatchResponseItem struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	Rule          string `json:"rule,omitempty"`
 }
@@ -1,7 +1,13 @@
 package model
 
+import "time"
+
 type CreateShortenerBody struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
 }
 
 type CreateShortenerResponse struct {
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+type DeleteJobAcceptedResponse struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+}
+
+type DeleteJobResponse struct {
+	JobID     string                  `json:"job_id"`
+	Status    string                  `json:"status"`
+	Attempts  int                     `json:"attempts"`
+	LastError string                  `json:"last_error,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+	UpdatedAt time.Time               `json:"updated_at"`
+	Items     []DeleteJobResponseItem `json:"items"`
+}
+
+type DeleteJobResponseItem struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+}
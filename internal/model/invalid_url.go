@@ -0,0 +1,8 @@
+package model
+
+// InvalidURLResponse объясняет, какое правило нарушил отклонённый URL.
+type InvalidURLResponse struct {
+	Error string `json:"error"`
+	Rule  string `json:"rule"`
+	URL   string `json:"url"`
+}
@@ -0,0 +1,13 @@
+package model
+
+type ClickStatsResponse struct {
+	ShortURL       string                    `json:"short_url"`
+	TotalClicks    int64                     `json:"total_clicks"`
+	UniqueVisitors int64                     `json:"unique_visitors"`
+	Daily          []DailyClicksResponseItem `json:"daily"`
+}
+
+type DailyClicksResponseItem struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
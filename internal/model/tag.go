@@ -0,0 +1,15 @@
+package model
+
+type TagResponseItem struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type RenameTagBody struct {
+	Name string `json:"name"`
+}
+
+type MergeTagsBody struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
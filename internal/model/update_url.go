@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type UpdateURLBody struct {
+	OriginalURL *string `json:"original_url,omitempty"`
+	// ExpiresAt: null снимает срок жизни ссылки.
+	ExpiresAt NullableTime `json:"expires_at"`
+	TTL       int64        `json:"ttl,omitempty"`
+	// Tags заменяет теги целиком, [] снимает все теги.
+	Tags *[]string `json:"tags,omitempty"`
+}
+
+// NullableTime отличает отсутствующее поле (Set == false) от явного null (Set и Value == nil).
+type NullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	t.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Value = &value
+	return nil
+}
+
+type UpdateURLResponse struct {
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	CanonicalURL string     `json:"canonical_url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+}
@@ -1,6 +1,15 @@
 package model
 
+import "time"
+
+// URLByUserBatchResponseItem — ссылка в списке пользователя. Истёкшие ссылки приходят
+// с is_deleted, как и удалённые; отличить их можно по expires_at.
 type URLByUserBatchResponseItem struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	CanonicalURL string     `json:"canonical_url,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	IsDeleted    bool       `json:"is_deleted,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
 }
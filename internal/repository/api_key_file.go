@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"time"
+)
+
+// APIKeyFileModel — снимок API ключа в журнале, при чтении побеждает последний снимок.
+type APIKeyFileModel struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_uuid"`
+	Name      string     `json:"name"`
+	KeyHash   string     `json:"key_hash"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func NewAPIKeyFileModel(key *domain.APIKey) *APIKeyFileModel {
+	return &APIKeyFileModel{
+		ID:        key.ID,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		KeyHash:   key.KeyHash,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+func (m *APIKeyFileModel) toDomain() domain.APIKey {
+	return domain.APIKey{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Name:      m.Name,
+		KeyHash:   m.KeyHash,
+		Prefix:    m.Prefix,
+		Scopes:    m.Scopes,
+		CreatedAt: m.CreatedAt,
+		RevokedAt: m.RevokedAt,
+	}
+}
+
+func apiKeysFileName(fileName string) string {
+	return fileName + ".keys"
+}
+
+type APIKeyFileWriter struct {
+	*jsonLinesWriter
+}
+
+func NewAPIKeyFileWriter(filename string, policy string) (*APIKeyFileWriter, error) {
+	writer, err := openJSONLinesWriter(filename, policy, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeyFileWriter{jsonLinesWriter: writer}, nil
+}
+
+func (a *APIKeyFileWriter) WriteAPIKey(key *APIKeyFileModel) error {
+	if err := a.write(key); err != nil {
+		return err
+	}
+	return a.flush()
+}
+
+func (a *APIKeyFileWriter) Sync() error {
+	return a.sync()
+}
+
+func (a *APIKeyFileWriter) Close() error {
+	return a.close()
+}
+
+func ReadAPIKeyFile(filename string) ([]APIKeyFileModel, error) {
+	var keys []APIKeyFileModel
+	_, err := replayJSONLines(filename, func(key APIKeyFileModel) {
+		keys = append(keys, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// apiKeyStore хранит API ключи в памяти для RAM и файлового хранилищ.
+type apiKeyStore struct {
+	mu     sync.RWMutex
+	byID   map[string]domain.APIKey
+	byHash map[string]string
+}
+
+func newAPIKeyStore() *apiKeyStore {
+	return &apiKeyStore{
+		byID:   make(map[string]domain.APIKey),
+		byHash: make(map[string]string),
+	}
+}
+
+func (s *apiKeyStore) put(key domain.APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.Scopes = append([]string(nil), key.Scopes...)
+	s.byID[key.ID] = key
+	s.byHash[key.KeyHash] = key.ID
+}
+
+func (s *apiKeyStore) getByHash(keyHash string) (*domain.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.byHash[keyHash]
+	if !exists {
+		return nil, errs.ErrAPIKeyNotFound
+	}
+	key := s.byID[id]
+	return &key, nil
+}
+
+func (s *apiKeyStore) getByUser(userID string) []domain.APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []domain.APIKey
+	for _, key := range s.byID {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// revoke возвращает отозванный ключ, чтобы файловое хранилище могло записать его в журнал.
+func (s *apiKeyStore) revoke(userID, id string, revokedAt time.Time) (*domain.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.byID[id]
+	if !exists || key.UserID != userID {
+		return nil, errs.ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		s.byID[id] = key
+	}
+	return &key, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testBackends перечисляет хранилища, которые можно поднять без внешних сервисов.
+func testBackends() map[string]func(t *testing.T) Repository {
+	return testBackendsWithScope(DedupeGlobal)
+}
+
+func testBackendsWithScope(dedupeScope string) map[string]func(t *testing.T) Repository {
+	return map[string]func(t *testing.T) Repository{
+		"ram": func(t *testing.T) Repository {
+			repo, err := NewRAMRepository(dedupeScope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return repo
+		},
+		"file": func(t *testing.T) Repository {
+			repo, err := NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), dedupeScope, FileRepositoryOptions{SyncPolicy: SyncNever})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { repo.Close() })
+			return repo
+		},
+		"sqlite": func(t *testing.T) Repository {
+			repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "shortener.db"), dedupeScope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { repo.Close() })
+			return repo
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+)
+
+// Исход вставки одного элемента пакета.
+const (
+	BatchItemCreated = "created"
+	// BatchItemExisted — ссылка на этот original_url уже есть, ShortURL указывает на неё.
+	BatchItemExisted = "existed"
+	// BatchItemShortURLTaken — короткий ID занят другой ссылкой, элемент не сохранён.
+	BatchItemShortURLTaken = "short_url_taken"
+)
+
+type BatchItemResult struct {
+	Status   string
+	ShortURL string
+}
+
+// newBatchItemResult переводит результат вставки одной ссылки в исход элемента пакета;
+// ошибки, не связанные с конфликтами, возвращаются как есть и прерывают пакет.
+func newBatchItemResult(shortURL string, err error) (BatchItemResult, error) {
+	if err == nil {
+		return BatchItemResult{Status: BatchItemCreated, ShortURL: shortURL}, nil
+	}
+	if existingErr := new(errs.OriginalURLAlreadyExists); errors.As(err, &existingErr) {
+		return BatchItemResult{Status: BatchItemExisted, ShortURL: existingErr.URL.ID}, nil
+	}
+	if takenErr := new(errs.ShortURLAlreadyExists); errors.As(err, &takenErr) {
+		return BatchItemResult{Status: BatchItemShortURLTaken, ShortURL: shortURL}, nil
+	}
+	return BatchItemResult{}, err
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"testing"
+)
+
+func TestAddBatchPerItemResults(t *testing.T) {
+	middleware.Initialize()
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+			if err := repo.Add(domain.NewURL("old", "https://old.example/", "user", false), ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := repo.AddBatch([]domain.URL{
+				*domain.NewURL("new", "https://new.example/", "user", false),
+				*domain.NewURL("dup", "https://old.example/", "user", false),
+				*domain.NewURL("old", "https://taken.example/", "user", false),
+				*domain.NewURL("again", "https://new.example/", "user", false),
+			}, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []BatchItemResult{
+				{Status: BatchItemCreated, ShortURL: "new"},
+				{Status: BatchItemExisted, ShortURL: "old"},
+				{Status: BatchItemShortURLTaken, ShortURL: "old"},
+				{Status: BatchItemExisted, ShortURL: "new"},
+			}
+			if len(results) != len(want) {
+				t.Fatalf("AddBatch() returned %d results, want %d", len(results), len(want))
+			}
+			for i := range want {
+				if results[i] != want[i] {
+					t.Errorf("AddBatch()[%d] = %+v, want %+v", i, results[i], want[i])
+				}
+			}
+
+			url, err := repo.Get("old", ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url.OriginalURL != "https://old.example/" {
+				t.Errorf("taken short URL was overwritten with %s", url.OriginalURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CacheOptions struct {
+	// Size — максимальное число ссылок в кеше; 0 отключает кеш.
+	Size int
+	TTL  time.Duration
+	// NegativeTTL — сколько помнить отсутствующие ссылки; держится коротким,
+	// потому что другая реплика может создать ссылку с этим ID.
+	NegativeTTL time.Duration
+}
+
+type CacheStats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+	Evictions    uint64
+}
+
+// HitRatio — доля запросов, обслуженных из кеша, включая отрицательные попадания.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.NegativeHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.NegativeHits) / float64(total)
+}
+
+// CachedRepository кеширует Get поверх любого Repository; остальные методы
+// делегируются как есть, а изменяющие ссылки сбрасывают соответствующие записи.
+type CachedRepository struct {
+	Repository
+	cache   *lruCache
+	lookups singleflight.Group
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+}
+
+func NewCachedRepository(repo Repository, options CacheOptions) *CachedRepository {
+	return &CachedRepository{
+		Repository: repo,
+		cache:      newLRUCache(options.Size, options.TTL, options.NegativeTTL),
+	}
+}
+
+func (c *CachedRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
+	if url, found := c.cache.get(id, time.Now()); found {
+		if url == nil {
+			c.negativeHits.Add(1)
+			return nil, errs.ErrURLNotFound
+		}
+		c.hits.Add(1)
+		return copyURL(url), nil
+	}
+	c.misses.Add(1)
+
+	// Параллельные промахи по одному ID превращаются в один запрос к хранилищу.
+	// Отмена контекста первого клиента не должна ронять запросы остальных.
+	result, err, _ := c.lookups.Do(id, func() (interface{}, error) {
+		generation := c.cache.currentGeneration()
+		url, err := c.Repository.Get(id, context.WithoutCancel(ctx))
+		if err != nil {
+			if errors.Is(err, errs.ErrURLNotFound) {
+				c.cache.putMissing(id, time.Now(), generation)
+			}
+			return nil, err
+		}
+		c.cache.put(id, url, time.Now(), generation)
+		return url, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyURL(result.(*domain.URL)), nil
+}
+
+func (c *CachedRepository) Add(url *domain.URL, ctx context.Context) error {
+	err := c.Repository.Add(url, ctx)
+	c.cache.remove(url.ID)
+	return err
+}
+
+func (c *CachedRepository) AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error) {
+	results, err := c.Repository.AddBatch(urls, ctx)
+	for _, url := range urls {
+		c.cache.remove(url.ID)
+	}
+	return results, err
+}
+
+func (c *CachedRepository) Update(ctx context.Context, url *domain.URL) error {
+	err := c.Repository.Update(ctx, url)
+	c.cache.remove(url.ID)
+	return err
+}
+
+func (c *CachedRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error) {
+	deleted, err := c.Repository.DeleteURLBatch(ctx, urls)
+	for _, shortURL := range deleted {
+		c.cache.remove(shortURL)
+	}
+	return deleted, err
+}
+
+func (c *CachedRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	count, err := c.Repository.DeleteExpired(ctx, now)
+	// Какие именно ссылки истекли, хранилище не сообщает
+	if count > 0 {
+		c.cache.purge()
+	}
+	return count, err
+}
+
+func (c *CachedRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) error {
+	err := c.Repository.MergeTags(ctx, userID, sources, target)
+	// Теги меняются у заранее неизвестного набора ссылок
+	if err == nil {
+		c.cache.purge()
+	}
+	return err
+}
+
+func (c *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.cache.evictions.Load(),
+	}
+}
+
+func copyURL(url *domain.URL) *domain.URL {
+	result := *url
+	return &result
+}
+
+type lruEntry struct {
+	key string
+	// url == nil означает закешированное отсутствие ссылки
+	url       *domain.URL
+	expiresAt time.Time
+}
+
+type lruCache struct {
+	mu          sync.Mutex
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	order       *list.List
+	entries     map[string]*list.Element
+	evictions   atomic.Uint64
+	// generation растёт при каждой инвалидации: результат чтения, начатого до неё,
+	// может быть устаревшим и в кеш не кладётся.
+	generation uint64
+}
+
+func newLRUCache(size int, ttl, negativeTTL time.Duration) *lruCache {
+	return &lruCache{
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key string, now time.Time) (*domain.URL, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !now.Before(entry.expiresAt) {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.url, true
+}
+
+func (c *lruCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *lruCache) put(key string, url *domain.URL, now time.Time, generation uint64) {
+	c.set(key, copyURL(url), now.Add(c.ttl), generation)
+}
+
+func (c *lruCache) putMissing(key string, now time.Time, generation uint64) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+	c.set(key, nil, now.Add(c.negativeTTL), generation)
+}
+
+func (c *lruCache) set(key string, url *domain.URL, expiresAt time.Time, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.url = url
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, url: url, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+func (c *lruCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+func (c *lruCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingRepository считает обращения к Get и может задерживать их, чтобы проверить singleflight.
+type countingRepository struct {
+	Repository
+	gets  atomic.Int64
+	delay time.Duration
+}
+
+func (r *countingRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
+	r.gets.Add(1)
+	time.Sleep(r.delay)
+	return r.Repository.Get(id, ctx)
+}
+
+func newTestCachedRepository(t *testing.T, options CacheOptions) (*CachedRepository, *countingRepository) {
+	t.Helper()
+
+	ram, err := NewRAMRepository(DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &countingRepository{Repository: ram}
+	return NewCachedRepository(backend, options), backend
+}
+
+func TestCachedRepositoryHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	cache, backend := newTestCachedRepository(t, CacheOptions{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute})
+
+	if _, err := cache.Get("abc", ctx); !errors.Is(err, errs.ErrURLNotFound) {
+		t.Fatalf("Get() error = %v, want %v", err, errs.ErrURLNotFound)
+	}
+	if _, err := cache.Get("abc", ctx); !errors.Is(err, errs.ErrURLNotFound) {
+		t.Fatalf("Get() error = %v, want %v", err, errs.ErrURLNotFound)
+	}
+
+	// Создание ссылки сбрасывает отрицательную запись
+	if err := cache.Add(domain.NewURL("abc", "https://practicum.yandex.ru/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		url, err := cache.Get("abc", ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url.OriginalURL != "https://practicum.yandex.ru/" {
+			t.Fatalf("Get().OriginalURL = %s", url.OriginalURL)
+		}
+	}
+
+	if err := cache.Update(ctx, domain.NewURL("abc", "https://yandex.ru/", "user", false)); err != nil {
+		t.Fatal(err)
+	}
+	url, err := cache.Get("abc", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url.OriginalURL != "https://yandex.ru/" {
+		t.Fatalf("Get() after Update returned stale %s", url.OriginalURL)
+	}
+
+	if _, err := cache.DeleteURLBatch(ctx, []UserShortURL{{UserID: "user", ShortURL: "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	url, err = cache.Get("abc", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !url.IsDeleted {
+		t.Fatal("Get() after DeleteURLBatch returned stale link")
+	}
+
+	if got := backend.gets.Load(); got != 4 {
+		t.Errorf("backend Get called %d times, want 4", got)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.NegativeHits != 1 || stats.Misses != 4 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestCachedRepositoryEvictionAndTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, backend := newTestCachedRepository(t, CacheOptions{Size: 2, TTL: 50 * time.Millisecond})
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := cache.Add(domain.NewURL(id, "https://example.com/"+id, "user", false), ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cache.Get(id, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 {
+		t.Fatalf("Evictions = %d, want 1", stats.Evictions)
+	}
+
+	backend.gets.Store(0)
+	cache.Get("c", ctx)
+	cache.Get("a", ctx)
+	if got := backend.gets.Load(); got != 1 {
+		t.Fatalf("backend Get called %d times, want 1 for evicted entry", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	backend.gets.Store(0)
+	cache.Get("c", ctx)
+	if got := backend.gets.Load(); got != 1 {
+		t.Fatalf("backend Get called %d times, want 1 for expired entry", got)
+	}
+}
+
+func TestCachedRepositoryCollapsesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	cache, backend := newTestCachedRepository(t, CacheOptions{Size: 10, TTL: time.Minute})
+	if err := cache.Add(domain.NewURL("abc", "https://practicum.yandex.ru/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	backend.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get("abc", ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := backend.gets.Load(); got != 1 {
+		t.Errorf("backend Get called %d times, want 1", got)
+	}
+}
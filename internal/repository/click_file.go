@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"time"
+)
+
+type ClickFileModel struct {
+	ShortURL  string    `json:"short_url"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash"`
+}
+
+func NewClickFileModel(click domain.Click) *ClickFileModel {
+	return &ClickFileModel{
+		ShortURL:  click.ShortURL,
+		ClickedAt: click.ClickedAt,
+		Referrer:  click.Referrer,
+		UserAgent: click.UserAgent,
+		IPHash:    click.IPHash,
+	}
+}
+
+func (m *ClickFileModel) toDomain() domain.Click {
+	return domain.Click{
+		ShortURL:  m.ShortURL,
+		ClickedAt: m.ClickedAt,
+		Referrer:  m.Referrer,
+		UserAgent: m.UserAgent,
+		IPHash:    m.IPHash,
+	}
+}
+
+func clicksFileName(fileName string) string {
+	return fileName + ".clicks"
+}
+
+type ClickFileWriter struct {
+	*jsonLinesWriter
+}
+
+func NewClickFileWriter(filename string, policy string) (*ClickFileWriter, error) {
+	writer, err := openJSONLinesWriter(filename, policy, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &ClickFileWriter{jsonLinesWriter: writer}, nil
+}
+
+// WriteClick только буферизует запись, на диск клики попадают при вызове Flush.
+func (c *ClickFileWriter) WriteClick(click *ClickFileModel) error {
+	return c.write(click)
+}
+
+func (c *ClickFileWriter) Flush() error {
+	return c.flush()
+}
+
+func (c *ClickFileWriter) Sync() error {
+	return c.sync()
+}
+
+func (c *ClickFileWriter) Close() error {
+	return c.close()
+}
+
+func ReadClickFile(filename string) ([]ClickFileModel, error) {
+	var clicks []ClickFileModel
+	_, err := replayJSONLines(filename, func(click ClickFileModel) {
+		clicks = append(clicks, click)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clicks, nil
+}
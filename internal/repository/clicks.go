@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"sort"
+	"time"
+)
+
+// aggregateClicks считает статистику переходов в памяти для файлового и RAM хранилищ.
+func aggregateClicks(shortURL string, clicks []domain.Click) *domain.ClickStats {
+	stats := &domain.ClickStats{ShortURL: shortURL}
+	visitors := make(map[string]struct{})
+	daily := make(map[time.Time]int64)
+
+	for _, click := range clicks {
+		stats.TotalClicks++
+		visitors[click.IPHash] = struct{}{}
+		day := click.ClickedAt.UTC().Truncate(24 * time.Hour)
+		daily[day]++
+	}
+	stats.UniqueVisitors = int64(len(visitors))
+
+	for day, count := range daily {
+		stats.Daily = append(stats.Daily, domain.DailyClicks{Day: day, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Day.Before(stats.Daily[j].Day)
+	})
+
+	return stats
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClickStatsDailyAggregation(t *testing.T) {
+	middleware.Initialize()
+	ctx := context.Background()
+
+	day1 := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	clicks := []domain.Click{
+		{ShortURL: "a", ClickedAt: day2.Add(time.Hour), IPHash: "h1"},
+		{ShortURL: "a", ClickedAt: day1.Add(23*time.Hour + 59*time.Minute), IPHash: "h1"},
+		{ShortURL: "a", ClickedAt: day1, IPHash: "h2"},
+		{ShortURL: "a", ClickedAt: day2.Add(2 * time.Hour), IPHash: "h3"},
+		{ShortURL: "b", ClickedAt: day1, IPHash: "h1"},
+	}
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			if err := repo.AddClicks(ctx, clicks); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := repo.GetClickStats(ctx, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalClicks != 4 || stats.UniqueVisitors != 3 {
+				t.Errorf("totals = %d clicks/%d visitors, want 4/3", stats.TotalClicks, stats.UniqueVisitors)
+			}
+			want := []domain.DailyClicks{{Day: day1, Clicks: 2}, {Day: day2, Clicks: 2}}
+			if !reflect.DeepEqual(stats.Daily, want) {
+				t.Errorf("Daily = %v, want %v", stats.Daily, want)
+			}
+
+			empty, err := repo.GetClickStats(ctx, "none")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if empty.TotalClicks != 0 || len(empty.Daily) != 0 {
+				t.Errorf("stats without clicks = %+v", empty)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	stressWorkers    = 8
+	stressIterations = 50
+)
+
+func TestRAMRepositoryConcurrentAccess(t *testing.T) {
+	middleware.Initialize()
+
+	repo, err := NewRAMRepository(DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stressRepository(t, repo)
+}
+
+func TestFileRepositoryConcurrentAccess(t *testing.T) {
+	middleware.Initialize()
+
+	// Низкий порог компакции, чтобы она срабатывала параллельно с остальными операциями
+	fileName := filepath.Join(t.TempDir(), "storage.json")
+	options := FileRepositoryOptions{SyncPolicy: SyncNever, CompactAfter: 100}
+	repo, err := NewFileRepository(fileName, DedupeGlobal, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stressRepository(t, repo)
+
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// После перезапуска должны восстановиться все ссылки и их пометки об удалении
+	reopened, err := NewFileRepository(fileName, DedupeGlobal, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	assertStressState(t, reopened)
+}
+
+// stressRepository параллельно добавляет, читает и удаляет ссылки разных пользователей.
+// Запускать с -race: тест ловит гонки, а не только панику "concurrent map writes".
+func stressRepository(t *testing.T, repo Repository) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, stressWorkers*stressIterations)
+
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			userID := fmt.Sprintf("user-%d", w)
+			ctx := context.WithValue(context.Background(), middleware.UserID{}, userID)
+
+			for i := 0; i < stressIterations; i++ {
+				single := stressURL(w, i, "single", userID)
+				if err := repo.Add(&single, ctx); err != nil {
+					errCh <- err
+					continue
+				}
+
+				batch := []domain.URL{stressURL(w, i, "batch-a", userID), stressURL(w, i, "batch-b", userID)}
+				if _, err := repo.AddBatch(batch, ctx); err != nil {
+					errCh <- err
+					continue
+				}
+
+				if _, err := repo.Get(single.ID, ctx); err != nil {
+					errCh <- err
+				}
+				if _, err := repo.GetURLsPage(ctx, URLPageQuery{UserID: userID, Now: time.Now()}); err != nil {
+					errCh <- err
+				}
+
+				_, err := repo.DeleteURLBatch(ctx, []UserShortURL{{UserID: userID, ShortURL: batch[0].ID}})
+				if err != nil {
+					errCh <- err
+				}
+				if _, err := repo.DeleteExpired(ctx, time.Now()); err != nil {
+					errCh <- err
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+
+	assertStressState(t, repo)
+}
+
+func assertStressState(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := context.Background()
+
+	for w := 0; w < stressWorkers; w++ {
+		for i := 0; i < stressIterations; i++ {
+			for suffix, wantDeleted := range map[string]bool{"single": false, "batch-a": true, "batch-b": false} {
+				id := stressID(w, i, suffix)
+				url, err := repo.Get(id, ctx)
+				if err != nil {
+					t.Fatalf("Get(%s): %v", id, err)
+				}
+				if url.IsDeleted != wantDeleted {
+					t.Fatalf("Get(%s).IsDeleted = %v, want %v", id, url.IsDeleted, wantDeleted)
+				}
+			}
+		}
+	}
+}
+
+func stressURL(w, i int, suffix, userID string) domain.URL {
+	id := stressID(w, i, suffix)
+	return *domain.NewURL(id, "https://example.com/"+id, userID, false)
+}
+
+func stressID(w, i int, suffix string) string {
+	return fmt.Sprintf("%d-%d-%s", w, i, suffix)
+}
@@ -2,20 +2,34 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/db"
 	"github.com/pervukhinpm/link-shortener.git/internal/errs"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
 	"github.com/pervukhinpm/link-shortener.git/internal/utils"
-	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	uniqueViolationCode = "23505"
+	shortURLConstraint  = "urls_short_url_key"
+	dedupeKeyConstraint = "urls_dedupe_key_key"
+)
+
+// urlTagsColumn выбирает отсортированные теги ссылки из url_tags.
+const urlTagsColumn = `ARRAY(SELECT t.name FROM url_tags ut JOIN tags t ON t.id = ut.tag_id
+	WHERE ut.short_url = urls.short_url ORDER BY t.name)`
+
 type DatabaseRepository struct {
-	db *pgxpool.Pool
+	db          *pgxpool.Pool
+	dedupeScope string
 }
 
 func (dr *DatabaseRepository) Close() error {
@@ -23,200 +37,845 @@ func (dr *DatabaseRepository) Close() error {
 	return nil
 }
 
-func NewDatabaseRepository(db *pgxpool.Pool) (*DatabaseRepository, error) {
-	dbRepository := DatabaseRepository{
-		db: db,
+func NewDatabaseRepository(pool *pgxpool.Pool, dedupeScope string) (*DatabaseRepository, error) {
+	if err := validateDedupeScope(dedupeScope); err != nil {
+		return nil, err
 	}
-	err := dbRepository.createDB()
+
+	migrator, err := db.NewMigrator(pool)
 	if err != nil {
 		return nil, err
 	}
-	return &dbRepository, nil
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyDedupeScope(context.Background(), pool, dedupeScope); err != nil {
+		return nil, fmt.Errorf("apply dedupe scope %q: %w", dedupeScope, err)
+	}
+
+	return &DatabaseRepository{
+		db:          pool,
+		dedupeScope: dedupeScope,
+	}, nil
+}
+
+// dedupeScopeLockID — ключ advisory lock, под которым реплики пересчитывают dedupe_key.
+const dedupeScopeLockID int64 = 7_240_151_338
+
+// applyDedupeScope пересчитывает ключи существующих ссылок, только если область
+// дедупликации отличается от записанной в settings; при ужесточении области уже
+// существующие дубли не дадут запуститься.
+func applyDedupeScope(ctx context.Context, pool *pgxpool.Pool, scope string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1);", dedupeScopeLockID); err != nil {
+		return err
+	}
+	var applied string
+	err = tx.QueryRow(ctx, "SELECT value FROM settings WHERE name = 'dedupe_scope';").Scan(&applied)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if applied == scope {
+		return nil
+	}
+
+	middleware.Log.Infow("Recomputing dedupe keys", "from", applied, "to", scope)
+	expr := dedupeKeySQL(scope)
+	if _, err := tx.Exec(ctx, "UPDATE urls SET dedupe_key = "+expr+" WHERE dedupe_key IS DISTINCT FROM "+expr); err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO settings (name, value) VALUES ('dedupe_scope', $1)
+	ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value;
+	`
+	if _, err := tx.Exec(ctx, query, scope); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (dr *DatabaseRepository) Add(url *domain.URL, ctx context.Context) error {
 	uuid, err := utils.GenerateUUID()
 	if err != nil {
-		middleware.Log.Error("Error generating uuid", zap.Error(err))
+		middleware.LogFromContext(ctx).Errorw("Error generating uuid", "error", err)
 		return err
 	}
 
 	query := `
-	INSERT INTO urls
-	VALUES ($1, $2, $3, $4, $5)
-    ON CONFLICT (original_url) DO NOTHING;
+	INSERT INTO urls (uuid, short_url, original_url, user_id, is_deleted, expires_at, created_at, dedupe_key, canonical_url)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+    ON CONFLICT (dedupe_key) WHERE NOT is_deleted DO NOTHING;
 	`
 
+	tx, err := dr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	userID := middleware.GetUserID(ctx)
-	result, err := dr.db.Exec(ctx, query, uuid, url.ID, url.OriginalURL, userID, url.IsDeleted)
+	canonicalURL := canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)
+	key := dedupeKey(dr.dedupeScope, userID, canonicalURL)
+	if key != nil {
+		if err := deleteExpiredDuplicates(ctx, tx, []string{*key}, url.ID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(ctx, query, uuid, url.ID, url.OriginalURL, userID, url.IsDeleted, url.ExpiresAt, ensureCreatedAt(url), key, canonicalURL)
 
 	if err != nil {
-		middleware.Log.Error("Error inserting url", zap.Error(err))
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == shortURLConstraint {
+			return errs.NewShortURLAlreadyExists(url.ID)
+		}
+		middleware.LogFromContext(ctx).Errorw("Error inserting url", "error", err)
 		return err
 	}
 
 	rowsAffected := result.RowsAffected()
 
 	if rowsAffected == 0 {
-		middleware.Log.Info("URL already exists, fetching existing short URL", zap.String("original_url", url.OriginalURL))
+		middleware.LogFromContext(ctx).Infow("URL already exists, fetching existing short URL", "original_url", url.OriginalURL)
 
-		existingShortURL, err := dr.getShortURLByOriginal(url.OriginalURL, ctx)
+		existingShortURL, err := dr.getShortURLByDedupeKey(*key, ctx)
 		if err != nil {
-			middleware.Log.Error("Error getting existing short URL", zap.Error(err))
+			middleware.LogFromContext(ctx).Errorw("Error getting existing short URL", "error", err)
 			return err
 		}
 
 		return errs.NewOriginalURLAlreadyExists(domain.NewURL(existingShortURL, url.OriginalURL, userID, false))
 	}
 
-	return nil
+	if err := setURLTags(ctx, tx, userID, url.ID, url.Tags); err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// setURLTags заменяет теги ссылки, заводя недостающие теги пользователя.
+func setURLTags(ctx context.Context, tx pgx.Tx, userID, shortURL string, tags []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM url_tags WHERE short_url = $1`, shortURL); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO tags (user_id, name) SELECT $1, unnest($2::varchar[])
+	ON CONFLICT (user_id, name) DO NOTHING;
+	`
+	if _, err := tx.Exec(ctx, query, userID, tags); err != nil {
+		return err
+	}
+	query = `
+	INSERT INTO url_tags (short_url, tag_id)
+	SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3::varchar[]);
+	`
+	_, err := tx.Exec(ctx, query, shortURL, userID, tags)
+	return err
 }
 
-func (dr *DatabaseRepository) getShortURLByOriginal(originalURL string, ctx context.Context) (string, error) {
+func (dr *DatabaseRepository) getShortURLByDedupeKey(key string, ctx context.Context) (string, error) {
 	query := `
-    SELECT short_url FROM urls WHERE original_url = $1;
+    SELECT short_url FROM urls WHERE dedupe_key = $1 AND NOT is_deleted;
     `
 	var shortURL string
-	err := dr.db.QueryRow(ctx, query, originalURL).Scan(&shortURL)
+	err := dr.db.QueryRow(ctx, query, key).Scan(&shortURL)
 	if err != nil {
 		return "", err
 	}
 	return shortURL, nil
 }
 
+// pgExecer — общий метод пула и транзакции.
+type pgExecer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// deleteExpiredDuplicates помечает удалёнными истёкшие, но ещё не убранные фоновой
+// очисткой ссылки с этими ключами, кроме самой shortURL, чтобы они не заняли уникальный индекс.
+func deleteExpiredDuplicates(ctx context.Context, db pgExecer, keys []string, shortURL string) error {
+	query := `
+	UPDATE urls SET is_deleted = TRUE
+	WHERE dedupe_key = ANY($1) AND short_url <> $2 AND NOT is_deleted AND expires_at IS NOT NULL AND expires_at <= $3;
+	`
+	_, err := db.Exec(ctx, query, keys, shortURL, time.Now())
+	return err
+}
+
 func (dr *DatabaseRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
 	query := `
-	SELECT original_url from urls WHERE short_url = $1;
+	SELECT original_url, canonical_url, user_id, is_deleted, expires_at, created_at, ` + urlTagsColumn + ` from urls WHERE short_url = $1;
 	`
 	originalURLRow := dr.db.QueryRow(ctx, query, id)
 
-	var originalURL string
-	err := originalURLRow.Scan(&originalURL)
+	var originalURL, canonicalURL, userID string
+	var isDeleted bool
+	var expiresAt *time.Time
+	var createdAt time.Time
+	var tags []string
+	err := originalURLRow.Scan(&originalURL, &canonicalURL, &userID, &isDeleted, &expiresAt, &createdAt, &tags)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errs.ErrURLNotFound
+		}
 		return nil, err
 	}
 
-	userID := middleware.GetUserID(ctx)
-	return domain.NewURL(id, originalURL, userID, false), nil
+	url := domain.NewURL(id, originalURL, userID, isDeleted)
+	url.ExpiresAt = expiresAt
+	url.CreatedAt = createdAt.UTC()
+	url.Tags = nonEmptyTags(tags)
+	url.CanonicalURL = canonicalURL
+	return url, nil
 }
 
-func (dr *DatabaseRepository) createDB() error {
+func (dr *DatabaseRepository) Update(ctx context.Context, url *domain.URL) error {
 	query := `
-	CREATE TABLE IF NOT EXISTS urls (
-		uuid varchar NOT NULL PRIMARY KEY,
-		short_url varchar NOT NULL UNIQUE,
-		original_url varchar NOT NULL UNIQUE,
-		user_id varchar NOT NULL,
-		is_deleted BOOLEAN NOT NULL DEFAULT FALSE
-	);`
-	_, err := dr.db.Exec(context.Background(), query)
-	return err
-}
-
-func (dr *DatabaseRepository) AddBatch(urls []domain.URL, ctx context.Context) error {
+	UPDATE urls SET original_url = $1, expires_at = $2, dedupe_key = $5, canonical_url = $6
+	WHERE short_url = $3 AND user_id = $4 AND NOT is_deleted;
+	`
+	canonicalURL := canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)
+	key := dedupeKey(dr.dedupeScope, url.UserID, canonicalURL)
 	tx, err := dr.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
+
+	if key != nil {
+		if err := deleteExpiredDuplicates(ctx, tx, []string{*key}, url.ID); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(ctx, query, url.OriginalURL, url.ExpiresAt, url.ID, url.UserID, key, canonicalURL)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == dedupeKeyConstraint {
+			existingShortURL, err := dr.getShortURLByDedupeKey(*key, ctx)
+			if err != nil {
+				return err
+			}
+			return errs.NewOriginalURLAlreadyExists(domain.NewURL(existingShortURL, url.OriginalURL, "", false))
+		}
+		middleware.LogFromContext(ctx).Errorw("Error updating url", "error", err)
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return errs.ErrURLNotFound
+	}
+	if err := setURLTags(ctx, tx, url.UserID, url.ID, url.Tags); err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AddBatch вставляет весь пакет одним запросом через unnest и в той же транзакции
+// сохраняет теги созданных ссылок. Строки, не прошедшие
+// ON CONFLICT, дозапрашиваются по dedupe_key: найденные уже существовали,
+// остальные упёрлись в занятый short_url.
+func (dr *DatabaseRepository) AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
 
 	userID := middleware.GetUserID(ctx)
 
+	uuids := make([]string, len(urls))
+	shortURLs := make([]string, len(urls))
+	originalURLs := make([]string, len(urls))
+	canonicalURLs := make([]string, len(urls))
+	dedupeKeys := make([]*string, len(urls))
+	expiresAt := make([]*time.Time, len(urls))
+	createdAt := make([]time.Time, len(urls))
+	for i, url := range urls {
+		uuid, err := utils.GenerateUUID()
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error generating uuid", "error", err)
+			return nil, err
+		}
+		uuids[i] = uuid
+		shortURLs[i] = url.ID
+		originalURLs[i] = url.OriginalURL
+		canonicalURLs[i] = canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)
+		dedupeKeys[i] = dedupeKey(dr.dedupeScope, userID, canonicalURLs[i])
+		expiresAt[i] = url.ExpiresAt
+		createdAt[i] = ensureCreatedAt(&url)
+	}
+
+	var keys []string
+	for _, key := range dedupeKeys {
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	tx, err := dr.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer tx.Rollback(ctx)
 
-	batch := &pgx.Batch{}
-	query := "INSERT INTO urls (uuid, short_url, original_url, user_id, is_deleted)" +
-		" VALUES ($1, $2, $3, $4, $5) ON CONFLICT (uuid) DO NOTHING"
+	if len(keys) > 0 {
+		if err := deleteExpiredDuplicates(ctx, tx, keys, ""); err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error deleting expired duplicates", "error", err)
+			return nil, err
+		}
+	}
 
-	for _, v := range urls {
-		uuid, err := utils.GenerateUUID()
+	query := `
+	INSERT INTO urls (uuid, short_url, original_url, user_id, is_deleted, expires_at, created_at, dedupe_key, canonical_url)
+	SELECT uuid, short_url, original_url, $8, FALSE, expires_at, created_at, dedupe_key, canonical_url
+	FROM unnest($1::varchar[], $2::varchar[], $3::varchar[], $4::timestamptz[], $5::timestamptz[], $6::varchar[], $7::varchar[])
+		WITH ORDINALITY AS batch(uuid, short_url, original_url, expires_at, created_at, dedupe_key, canonical_url, ord)
+	ORDER BY ord
+	ON CONFLICT DO NOTHING
+	RETURNING short_url;
+	`
+	rows, err := tx.Query(ctx, query, uuids, shortURLs, originalURLs, expiresAt, createdAt, dedupeKeys, canonicalURLs, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting url batch", "error", err)
+		return nil, err
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting url batch", "error", err)
+		return nil, err
+	}
+
+	created := make(map[string]bool, len(inserted))
+	for _, shortURL := range inserted {
+		created[shortURL] = true
+	}
+
+	results := make([]BatchItemResult, len(urls))
+	var skipped []string
+	for i, url := range urls {
+		if created[url.ID] {
+			results[i] = BatchItemResult{Status: BatchItemCreated, ShortURL: url.ID}
+			// Повтор того же short_url в пакете вставлен не был
+			delete(created, url.ID)
+			if err := setURLTags(ctx, tx, userID, url.ID, url.Tags); err != nil {
+				middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+				return nil, err
+			}
+			continue
+		}
+		if dedupeKeys[i] != nil {
+			skipped = append(skipped, *dedupeKeys[i])
+		}
+	}
+
+	var existing map[string]string
+	if len(skipped) > 0 {
+		existing, err = getShortURLsByDedupeKey(ctx, tx, skipped)
 		if err != nil {
-			middleware.Log.Error("Error generating uuid", zap.Error(err))
-			return err
+			middleware.LogFromContext(ctx).Errorw("Error getting existing short URLs", "error", err)
+			return nil, err
 		}
-		batch.Queue(query, uuid, v.ID, v.OriginalURL, userID, v.IsDeleted)
 	}
-	dr.db.SendBatch(ctx, batch)
-	return tx.Commit(ctx)
+	for i, url := range urls {
+		if results[i].Status != "" {
+			continue
+		}
+		if dedupeKeys[i] != nil {
+			if shortURL, ok := existing[*dedupeKeys[i]]; ok {
+				results[i] = BatchItemResult{Status: BatchItemExisted, ShortURL: shortURL}
+				continue
+			}
+		}
+		results[i] = BatchItemResult{Status: BatchItemShortURLTaken, ShortURL: url.ID}
+	}
+	return results, tx.Commit(ctx)
 }
 
-func (dr *DatabaseRepository) GetByUserID(ctx context.Context) (*[]domain.URL, error) {
-	userID := middleware.GetUserID(ctx)
+func getShortURLsByDedupeKey(ctx context.Context, tx pgx.Tx, keys []string) (map[string]string, error) {
+	query := `
+	SELECT dedupe_key, short_url FROM urls WHERE dedupe_key = ANY($1) AND NOT is_deleted;
+	`
+	rows, err := tx.Query(ctx, query, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var key, shortURL string
+		if err := rows.Scan(&key, &shortURL); err != nil {
+			return nil, err
+		}
+		result[key] = shortURL
+	}
+	return result, rows.Err()
+}
+
+func (dr *DatabaseRepository) GetURLsPage(ctx context.Context, query URLPageQuery) ([]domain.URL, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{query.UserID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "NOT is_deleted", "(expires_at IS NULL OR expires_at > "+arg(query.Now)+")")
+	}
+	if query.Search != "" {
+		conditions = append(conditions, "strpos(original_url, "+arg(query.Search)+") > 0")
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM url_tags ut JOIN tags t ON t.id = ut.tag_id "+
+			"WHERE ut.short_url = urls.short_url AND t.name = "+arg(query.Tag)+")")
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+arg(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*query.CreatedBefore))
+	}
+	order := "ASC"
+	if query.Descending {
+		order = "DESC"
+	}
+	if query.After != nil {
+		comparison := ">"
+		if query.Descending {
+			comparison = "<"
+		}
+		conditions = append(conditions, "(created_at, short_url) "+comparison+
+			" ("+arg(query.After.CreatedAt)+"::timestamptz, "+arg(query.After.ShortURL)+"::varchar)")
+	}
 
+	sqlQuery := "SELECT short_url, original_url, canonical_url, is_deleted, expires_at, created_at, " + urlTagsColumn + " FROM urls WHERE " +
+		strings.Join(conditions, " AND ") +
+		" ORDER BY created_at " + order + ", short_url " + order
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT " + arg(query.Limit)
+	}
+
+	rows, err := dr.db.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying URLs page", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []domain.URL
+	for rows.Next() {
+		var shortURL, originalURL, canonicalURL string
+		var isDeleted bool
+		var expiresAt *time.Time
+		var createdAt time.Time
+		var tags []string
+		if err := rows.Scan(&shortURL, &originalURL, &canonicalURL, &isDeleted, &expiresAt, &createdAt, &tags); err != nil {
+			return nil, err
+		}
+		url := domain.NewURL(shortURL, originalURL, query.UserID, isDeleted)
+		url.ExpiresAt = expiresAt
+		url.CreatedAt = createdAt.UTC()
+		url.Tags = nonEmptyTags(tags)
+		url.CanonicalURL = canonicalURL
+		urls = append(urls, *url)
+	}
+	return urls, rows.Err()
+}
+
+func (dr *DatabaseRepository) GetTags(ctx context.Context, userID string) ([]domain.TagCount, error) {
 	query := `
-    SELECT short_url, original_url, is_deleted FROM urls WHERE user_id = $1;
-    `
+	SELECT t.name, count(*) FROM tags t
+	JOIN url_tags ut ON ut.tag_id = t.id
+	JOIN urls u ON u.short_url = ut.short_url
+	WHERE t.user_id = $1 AND NOT u.is_deleted
+	GROUP BY t.name ORDER BY t.name;
+	`
 	rows, err := dr.db.Query(ctx, query, userID)
 	if err != nil {
-		middleware.Log.Error("Error querying URLs by user ID", zap.Error(err))
+		middleware.LogFromContext(ctx).Errorw("Error querying tags", "error", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var urls []domain.URL
+	result := []domain.TagCount{}
+	for rows.Next() {
+		var tag domain.TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, tag)
+	}
+	return result, rows.Err()
+}
+
+// MergeTags переносит связи source-тегов на target и удаляет source-теги;
+// их url_tags удаляются каскадом.
+func (dr *DatabaseRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) error {
+	tx, err := dr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT DISTINCT t.id FROM tags t JOIN url_tags ut ON ut.tag_id = t.id
+	WHERE t.user_id = $1 AND t.name = ANY($2::varchar[]);
+	`
+	rows, err := tx.Query(ctx, query, userID, sources)
+	if err != nil {
+		return err
+	}
+	sourceIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return err
+	}
+	if len(sourceIDs) == 0 {
+		return errs.ErrTagNotFound
+	}
+
+	query = `
+	INSERT INTO tags (user_id, name) VALUES ($1, $2)
+	ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+	RETURNING id;
+	`
+	var targetID int64
+	if err := tx.QueryRow(ctx, query, userID, target).Scan(&targetID); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO url_tags (short_url, tag_id)
+	SELECT short_url, $1 FROM url_tags WHERE tag_id = ANY($2::bigint[])
+	ON CONFLICT DO NOTHING;
+	`
+	if _, err := tx.Exec(ctx, query, targetID, sourceIDs); err != nil {
+		return err
+	}
+	query = `
+	DELETE FROM tags WHERE user_id = $1 AND name = ANY($2::varchar[]);
+	`
+	if _, err := tx.Exec(ctx, query, userID, sources); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// nonEmptyTags приводит пустой список тегов к nil, как в остальных хранилищах.
+func nonEmptyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func (dr *DatabaseRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error) {
+	userIDs := make([]string, len(urls))
+	shortURLs := make([]string, len(urls))
+	for i, v := range urls {
+		userIDs[i] = v.UserID
+		shortURLs[i] = v.ShortURL
+	}
+
+	query := `
+	UPDATE urls SET is_deleted = TRUE
+	FROM unnest($1::varchar[], $2::varchar[]) AS d(user_id, short_url)
+	WHERE urls.user_id = d.user_id AND urls.short_url = d.short_url
+	RETURNING urls.short_url;
+	`
+	rows, err := dr.db.Query(ctx, query, userIDs, shortURLs)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error deleting short URLs", "error", err)
+		return nil, err
+	}
+
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error deleting short URLs", "error", err)
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func (dr *DatabaseRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+	UPDATE urls SET is_deleted = TRUE
+	WHERE expires_at IS NOT NULL AND expires_at <= $1 AND NOT is_deleted;
+	`
+	result, err := dr.db.Exec(ctx, query, now)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error deleting expired urls", "error", err)
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+func (dr *DatabaseRepository) AddClicks(ctx context.Context, clicks []domain.Click) error {
+	_, err := dr.db.CopyFrom(
+		ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"short_url", "clicked_at", "referrer", "user_agent", "ip_hash"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			c := clicks[i]
+			return []any{c.ShortURL, c.ClickedAt, c.Referrer, c.UserAgent, c.IPHash}, nil
+		}),
+	)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting clicks", "error", err)
+	}
+	return err
+}
+
+func (dr *DatabaseRepository) GetClickStats(ctx context.Context, shortURL string) (*domain.ClickStats, error) {
+	stats := &domain.ClickStats{ShortURL: shortURL}
+
+	totalsQuery := `
+	SELECT count(*), count(DISTINCT ip_hash) FROM clicks WHERE short_url = $1;
+	`
+	err := dr.db.QueryRow(ctx, totalsQuery, shortURL).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying click totals", "error", err)
+		return nil, err
+	}
+
+	dailyQuery := `
+	SELECT date_trunc('day', clicked_at AT TIME ZONE 'UTC') AS day, count(*)
+	FROM clicks WHERE short_url = $1
+	GROUP BY day ORDER BY day;
+	`
+	rows, err := dr.db.Query(ctx, dailyQuery, shortURL)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying daily clicks", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var shortURL, originalURL string
-		var isDeleted bool
-		err := rows.Scan(&shortURL, &originalURL, &isDeleted)
-		if err != nil {
-			middleware.Log.Error("Error scanning row", zap.Error(err))
+		var daily domain.DailyClicks
+		if err := rows.Scan(&daily.Day, &daily.Clicks); err != nil {
 			return nil, err
 		}
+		daily.Day = time.Date(daily.Day.Year(), daily.Day.Month(), daily.Day.Day(), 0, 0, 0, 0, time.UTC)
+		stats.Daily = append(stats.Daily, daily)
+	}
 
-		urls = append(urls, domain.URL{
-			ID:          shortURL,
-			OriginalURL: originalURL,
-			UserID:      userID,
-			IsDeleted:   isDeleted,
-		})
+	return stats, rows.Err()
+}
+
+func (dr *DatabaseRepository) AddDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	tx, err := dr.db.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if err := rows.Err(); err != nil {
-		middleware.Log.Error("Error iterating over rows", zap.Error(err))
+	query := `
+	INSERT INTO delete_jobs (id, user_id, status, attempts, last_error, run_after, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+	_, err = tx.Exec(ctx, query, job.ID, job.UserID, job.Status, job.Attempts, job.LastError, job.RunAfter, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting delete job", "error", err)
+		return err
+	}
+
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"delete_job_items"},
+		[]string{"job_id", "position", "short_url", "status"},
+		pgx.CopyFromSlice(len(job.Items), func(i int) ([]any, error) {
+			return []any{job.ID, i, job.Items[i].ShortURL, job.Items[i].Status}, nil
+		}),
+	)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting delete job items", "error", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (dr *DatabaseRepository) ClaimDeleteJob(ctx context.Context, now time.Time, lease time.Duration) (*domain.DeleteJob, error) {
+	// SKIP LOCKED позволяет нескольким репликам разбирать очередь, не блокируя друг друга
+	query := `
+	UPDATE delete_jobs SET status = $1, attempts = attempts + 1, run_after = $2, updated_at = $3
+	WHERE id = (
+		SELECT id FROM delete_jobs
+		WHERE status IN ('pending', 'running') AND run_after <= $3
+		ORDER BY created_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING id, user_id, status, attempts, last_error, run_after, created_at, updated_at;
+	`
+	var job domain.DeleteJob
+	err := dr.db.QueryRow(ctx, query, domain.DeleteJobRunning, now.Add(lease), now).Scan(
+		&job.ID, &job.UserID, &job.Status, &job.Attempts, &job.LastError, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		middleware.LogFromContext(ctx).Errorw("Error claiming delete job", "error", err)
 		return nil, err
 	}
 
-	return &urls, nil
+	job.Items, err = dr.getDeleteJobItems(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
 }
 
-func (dr *DatabaseRepository) GetFlagByShortURL(ctx context.Context, shortenedURL string) (bool, error) {
+func (dr *DatabaseRepository) SaveDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	tx, err := dr.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	jobQuery := `
+	UPDATE delete_jobs SET status = $1, attempts = $2, last_error = $3, run_after = $4, updated_at = $5
+	WHERE id = $6;
+	`
+	_, err = tx.Exec(ctx, jobQuery, job.Status, job.Attempts, job.LastError, job.RunAfter, job.UpdatedAt, job.ID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error updating delete job", "error", err)
+		return err
+	}
+
+	positions := make([]int32, len(job.Items))
+	statuses := make([]string, len(job.Items))
+	for i, item := range job.Items {
+		positions[i] = int32(i)
+		statuses[i] = item.Status
+	}
+
+	itemsQuery := `
+	UPDATE delete_job_items SET status = d.status
+	FROM unnest($2::integer[], $3::varchar[]) AS d(position, status)
+	WHERE delete_job_items.job_id = $1 AND delete_job_items.position = d.position;
+	`
+	_, err = tx.Exec(ctx, itemsQuery, job.ID, positions, statuses)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error updating delete job items", "error", err)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (dr *DatabaseRepository) CountActiveDeleteJobs(ctx context.Context) (int64, error) {
 	query := `
-        SELECT is_deleted
-        FROM urls
-        WHERE short_url = $1;
-    `
+	SELECT count(*) FROM delete_jobs WHERE status IN ('pending', 'running');
+	`
+	var count int64
+	err := dr.db.QueryRow(ctx, query).Scan(&count)
+	return count, err
+}
 
-	var isDeleted bool
-	err := dr.db.QueryRow(ctx, query, shortenedURL).Scan(&isDeleted)
+func (dr *DatabaseRepository) GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error) {
+	query := `
+	SELECT id, user_id, status, attempts, last_error, run_after, created_at, updated_at
+	FROM delete_jobs WHERE id = $1;
+	`
+	var job domain.DeleteJob
+	err := dr.db.QueryRow(ctx, query, id).Scan(
+		&job.ID, &job.UserID, &job.Status, &job.Attempts, &job.LastError, &job.RunAfter, &job.CreatedAt, &job.UpdatedAt,
+	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, errs.ErrURLNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errs.ErrJobNotFound
 		}
-		middleware.Log.Error("Error querying short URL", zap.Error(err))
-		return false, err
+		return nil, err
 	}
 
-	return isDeleted, nil
+	job.Items, err = dr.getDeleteJobItems(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
 }
 
-func (dr *DatabaseRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) error {
-	query := `UPDATE urls SET is_deleted = $1 WHERE user_id = $2 AND short_url = $3;`
-	batch := &pgx.Batch{}
-	for _, v := range urls {
-		batch.Queue(query, true, v.UserID, v.ShortURL)
+func (dr *DatabaseRepository) getDeleteJobItems(ctx context.Context, jobID string) ([]domain.DeleteJobItem, error) {
+	query := `
+	SELECT short_url, status FROM delete_job_items WHERE job_id = $1 ORDER BY position;
+	`
+	rows, err := dr.db.Query(ctx, query, jobID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying delete job items", "error", err)
+		return nil, err
 	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[domain.DeleteJobItem])
+}
 
-	br := dr.db.SendBatch(ctx, batch)
-	defer br.Close()
+func (dr *DatabaseRepository) AddAPIKey(ctx context.Context, key *domain.APIKey) error {
+	query := `
+	INSERT INTO api_keys (id, user_id, name, key_hash, prefix, scopes, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	_, err := dr.db.Exec(ctx, query, key.ID, key.UserID, key.Name, key.KeyHash, key.Prefix, scopes, key.CreatedAt)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting api key", "error", err)
+	}
+	return err
+}
 
-	for _, v := range urls {
-		_, err := br.Exec()
-		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				middleware.Log.Error("Error deleting short URL %v, %v\n", v.ShortURL, zap.Error(err))
-			}
+func (dr *DatabaseRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	query := `
+	SELECT id, user_id, name, key_hash, prefix, scopes, created_at, revoked_at
+	FROM api_keys WHERE key_hash = $1;
+	`
+	rows, err := dr.db.Query(ctx, query, keyHash)
+	if err != nil {
+		return nil, err
+	}
+	key, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByPos[domain.APIKey])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errs.ErrAPIKeyNotFound
 		}
+		return nil, err
 	}
-	return br.Close()
+	return key, nil
+}
+
+func (dr *DatabaseRepository) GetAPIKeysByUser(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	query := `
+	SELECT id, user_id, name, key_hash, prefix, scopes, created_at, revoked_at
+	FROM api_keys WHERE user_id = $1 ORDER BY created_at;
+	`
+	rows, err := dr.db.Query(ctx, query, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying api keys", "error", err)
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[domain.APIKey])
+}
+
+func (dr *DatabaseRepository) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	query := `
+	UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2 AND user_id = $3;
+	`
+	result, err := dr.db.Exec(ctx, query, revokedAt, id, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error revoking api key", "error", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return errs.ErrAPIKeyNotFound
+	}
+	return nil
 }
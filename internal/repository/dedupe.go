@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// Где ищутся дубли original_url: среди всех ссылок, среди ссылок того же
+// пользователя или нигде.
+const (
+	DedupeGlobal = "global"
+	DedupeUser   = "user"
+	DedupeNone   = "none"
+)
+
+func validateDedupeScope(scope string) error {
+	switch scope {
+	case DedupeGlobal, DedupeUser, DedupeNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown dedupe scope %q", scope)
+	}
+}
+
+// isDuplicate сообщает, считается ли ссылка пользователя userID на canonicalURL
+// дублем существующей ссылки.
+func isDuplicate(scope, existingUserID, existingURL, userID, canonicalURL string) bool {
+	switch scope {
+	case DedupeNone:
+		return false
+	case DedupeUser:
+		if existingUserID != userID {
+			return false
+		}
+	}
+	return existingURL == canonicalURL
+}
+
+// blocksDedupe — удалённые и истёкшие ссылки дублей не образуют: тот же URL
+// можно сократить заново.
+func blocksDedupe(isDeleted bool, expiresAt *time.Time, now time.Time) bool {
+	return !isDeleted && (expiresAt == nil || now.Before(*expiresAt))
+}
+
+// canonicalOrOriginal — ссылки, сохранённые до появления канонизации,
+// дедуплицируются по исходному URL.
+func canonicalOrOriginal(canonicalURL, originalURL string) string {
+	if canonicalURL != "" {
+		return canonicalURL
+	}
+	return originalURL
+}
+
+// dedupeKey — значение колонки dedupe_key в SQL-хранилищах; на ней висит уникальный
+// индекс, а NULL дублей не образует.
+func dedupeKey(scope, userID, canonicalURL string) *string {
+	var key string
+	switch scope {
+	case DedupeNone:
+		return nil
+	case DedupeUser:
+		key = userID + "|" + canonicalURL
+	default:
+		key = canonicalURL
+	}
+	return &key
+}
+
+// dedupeKeySQL вычисляет тот же ключ в SQL; им пересчитываются существующие строки,
+// если область дедупликации поменялась.
+func dedupeKeySQL(scope string) string {
+	switch scope {
+	case DedupeNone:
+		return "NULL"
+	case DedupeUser:
+		return "user_id || '|' || canonical_url"
+	default:
+		return "canonical_url"
+	}
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupeScope(t *testing.T) {
+	middleware.Initialize()
+
+	tests := []struct {
+		scope          string
+		wantSameUser   bool
+		wantOtherUser  bool
+		wantBatchDedup bool
+	}{
+		{scope: DedupeGlobal, wantSameUser: true, wantOtherUser: true, wantBatchDedup: true},
+		{scope: DedupeUser, wantSameUser: true, wantOtherUser: false, wantBatchDedup: true},
+		{scope: DedupeNone, wantSameUser: false, wantOtherUser: false, wantBatchDedup: false},
+	}
+	for _, tt := range tests {
+		for name, newRepo := range testBackendsWithScope(tt.scope) {
+			t.Run(tt.scope+"/"+name, func(t *testing.T) {
+				repo := newRepo(t)
+				alice := context.WithValue(context.Background(), middleware.UserID{}, "alice")
+				bob := context.WithValue(context.Background(), middleware.UserID{}, "bob")
+
+				add := func(ctx context.Context, id string) error {
+					return repo.Add(domain.NewURL(id, "https://example.com/", middleware.GetUserID(ctx), false), ctx)
+				}
+				if err := add(alice, "a1"); err != nil {
+					t.Fatal(err)
+				}
+
+				existingErr := new(errs.OriginalURLAlreadyExists)
+				err := add(alice, "a2")
+				if gotDuplicate := errors.As(err, &existingErr); gotDuplicate != tt.wantSameUser {
+					t.Errorf("same user duplicate: err = %v, want duplicate %v", err, tt.wantSameUser)
+				} else if !gotDuplicate && err != nil {
+					t.Fatal(err)
+				}
+
+				err = add(bob, "b1")
+				if gotDuplicate := errors.As(err, &existingErr); gotDuplicate != tt.wantOtherUser {
+					t.Errorf("other user duplicate: err = %v, want duplicate %v", err, tt.wantOtherUser)
+				} else if !gotDuplicate && err != nil {
+					t.Fatal(err)
+				}
+
+				results, err := repo.AddBatch([]domain.URL{
+					*domain.NewURL("c1", "https://batch.example/", "carol", false),
+					*domain.NewURL("c2", "https://batch.example/", "carol", false),
+				}, context.WithValue(context.Background(), middleware.UserID{}, "carol"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantStatus := BatchItemCreated
+				if tt.wantBatchDedup {
+					wantStatus = BatchItemExisted
+				}
+				if results[1].Status != wantStatus {
+					t.Errorf("batch duplicate status = %s, want %s", results[1].Status, wantStatus)
+				}
+			})
+		}
+	}
+
+	if _, err := NewRAMRepository("everyone"); err == nil {
+		t.Error("NewRAMRepository() error = nil for unknown dedupe scope")
+	}
+}
+
+func TestDedupeByCanonicalURL(t *testing.T) {
+	middleware.Initialize()
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+			first := domain.NewURL("a", "HTTPS://Example.com/", "user", false)
+			first.CanonicalURL = "https://example.com/"
+			if err := repo.Add(first, ctx); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := repo.Get("a", ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.OriginalURL != first.OriginalURL || stored.CanonicalURL != first.CanonicalURL {
+				t.Errorf("Get() = %q/%q, want %q/%q", stored.OriginalURL, stored.CanonicalURL, first.OriginalURL, first.CanonicalURL)
+			}
+
+			second := domain.NewURL("b", "https://example.com:443", "user", false)
+			second.CanonicalURL = "https://example.com/"
+			existingErr := new(errs.OriginalURLAlreadyExists)
+			if err := repo.Add(second, ctx); !errors.As(err, &existingErr) || existingErr.URL.ID != "a" {
+				t.Errorf("Add() equivalent URL error = %v, want existing link a", err)
+			}
+		})
+	}
+}
+
+func TestDedupeIgnoresDeletedAndExpired(t *testing.T) {
+	middleware.Initialize()
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+			past := time.Now().Add(-time.Hour)
+
+			if err := repo.Add(domain.NewURL("a", "https://deleted.example/", "user", false), ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.DeleteURLBatch(ctx, []UserShortURL{{UserID: "user", ShortURL: "a"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Add(domain.NewURL("b", "https://deleted.example/", "user", false), ctx); err != nil {
+				t.Errorf("Add() after delete error = %v, want nil", err)
+			}
+
+			expired := domain.NewURL("c", "https://expired.example/", "user", false)
+			expired.ExpiresAt = &past
+			if err := repo.Add(expired, ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Add(domain.NewURL("d", "https://expired.example/", "user", false), ctx); err != nil {
+				t.Errorf("Add() after expiry error = %v, want nil", err)
+			}
+
+			reaped := domain.NewURL("e", "https://reaped.example/", "user", false)
+			reaped.ExpiresAt = &past
+			if err := repo.Add(reaped, ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.DeleteExpired(ctx, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			results, err := repo.AddBatch([]domain.URL{*domain.NewURL("f", "https://reaped.example/", "user", false)}, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Status != BatchItemCreated {
+				t.Errorf("AddBatch() after cleanup status = %s, want %s", results[0].Status, BatchItemCreated)
+			}
+
+			existingErr := new(errs.OriginalURLAlreadyExists)
+			err = repo.Add(domain.NewURL("g", "https://deleted.example/", "user", false), ctx)
+			if !errors.As(err, &existingErr) || existingErr.URL.ID != "b" {
+				t.Errorf("Add() duplicate of live link error = %v, want existing link b", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteMigratesUniqueOriginalURL(t *testing.T) {
+	middleware.Initialize()
+
+	path := filepath.Join(t.TempDir(), "shortener.db")
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := `
+	CREATE TABLE urls (
+		uuid TEXT NOT NULL PRIMARY KEY,
+		short_url TEXT NOT NULL UNIQUE,
+		original_url TEXT NOT NULL UNIQUE,
+		user_id TEXT NOT NULL,
+		is_deleted INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER,
+		created_at INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE tags (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id TEXT NOT NULL, name TEXT NOT NULL, UNIQUE (user_id, name));
+	CREATE TABLE url_tags (
+		short_url TEXT NOT NULL REFERENCES urls (short_url) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (short_url, tag_id)
+	);
+	INSERT INTO urls (uuid, short_url, original_url, user_id) VALUES ('u1', 'old', 'https://example.com/', 'alice');
+	INSERT INTO tags (user_id, name) VALUES ('alice', 'go');
+	INSERT INTO url_tags (short_url, tag_id) VALUES ('old', 1);`
+	if _, err := db.Exec(legacy); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	repo, err := NewSQLiteRepository(path, DedupeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	bob := context.WithValue(context.Background(), middleware.UserID{}, "bob")
+	if err := repo.Add(domain.NewURL("new", "https://example.com/", "bob", false), bob); err != nil {
+		t.Fatalf("Add() for another user after migration: %v", err)
+	}
+
+	alice := context.WithValue(context.Background(), middleware.UserID{}, "alice")
+	err = repo.Add(domain.NewURL("again", "https://example.com/", "alice", false), alice)
+	if existingErr := new(errs.OriginalURLAlreadyExists); !errors.As(err, &existingErr) || existingErr.URL.ID != "old" {
+		t.Errorf("Add() duplicate for the same user error = %v, want existing link old", err)
+	}
+
+	url, err := repo.Get("old", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(url.Tags) != 1 || url.Tags[0] != "go" {
+		t.Errorf("tags after migration = %v, want [go]", url.Tags)
+	}
+}
+
+func TestSQLiteReplacesFullDedupeIndex(t *testing.T) {
+	middleware.Initialize()
+
+	path := filepath.Join(t.TempDir(), "shortener.db")
+	repo, err := NewSQLiteRepository(path, DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.db.Exec(`
+	DROP INDEX urls_dedupe_key_key;
+	CREATE UNIQUE INDEX urls_dedupe_key_key ON urls (dedupe_key);`)
+	repo.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = NewSQLiteRepository(path, DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	if err := repo.Add(domain.NewURL("a", "https://example.com/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.DeleteURLBatch(ctx, []UserShortURL{{UserID: "user", ShortURL: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(domain.NewURL("b", "https://example.com/", "user", false), ctx); err != nil {
+		t.Errorf("Add() after delete error = %v, want nil", err)
+	}
+}
+
+func TestSQLiteRecomputesDedupeKeysOnScopeChange(t *testing.T) {
+	middleware.Initialize()
+
+	path := filepath.Join(t.TempDir(), "shortener.db")
+	open := func(scope string) *SQLiteRepository {
+		repo, err := NewSQLiteRepository(path, scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+	dedupeKeyOf := func(repo *SQLiteRepository, shortURL string) string {
+		var key sql.NullString
+		if err := repo.db.QueryRow(`SELECT dedupe_key FROM urls WHERE short_url = ?;`, shortURL).Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		return key.String
+	}
+
+	repo := open(DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "alice")
+	if err := repo.Add(domain.NewURL("a", "https://example.com/", "alice", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Ключ, не совпадающий с областью, переживает перезапуск с той же областью
+	if _, err := repo.db.Exec(`UPDATE urls SET dedupe_key = 'stale' WHERE short_url = 'a';`); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	repo = open(DedupeGlobal)
+	if got := dedupeKeyOf(repo, "a"); got != "stale" {
+		t.Errorf("dedupe_key with unchanged scope = %q, want stale", got)
+	}
+	repo.Close()
+
+	repo = open(DedupeUser)
+	defer repo.Close()
+	if got, want := dedupeKeyOf(repo, "a"), "alice|https://example.com/"; got != want {
+		t.Errorf("dedupe_key after scope change = %q, want %q", got, want)
+	}
+}
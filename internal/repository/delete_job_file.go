@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"time"
+)
+
+// DeleteJobFileModel — снимок состояния задачи удаления в журнале.
+// При чтении журнала побеждает последний снимок задачи.
+type DeleteJobFileModel struct {
+	ID        string                   `json:"id"`
+	UserID    string                   `json:"user_uuid"`
+	Status    string                   `json:"status"`
+	Attempts  int                      `json:"attempts"`
+	LastError string                   `json:"last_error,omitempty"`
+	RunAfter  time.Time                `json:"run_after"`
+	CreatedAt time.Time                `json:"created_at"`
+	UpdatedAt time.Time                `json:"updated_at"`
+	Items     []DeleteJobItemFileModel `json:"items"`
+}
+
+type DeleteJobItemFileModel struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+}
+
+func NewDeleteJobFileModel(job *domain.DeleteJob) *DeleteJobFileModel {
+	items := make([]DeleteJobItemFileModel, len(job.Items))
+	for i, item := range job.Items {
+		items[i] = DeleteJobItemFileModel{ShortURL: item.ShortURL, Status: item.Status}
+	}
+	return &DeleteJobFileModel{
+		ID:        job.ID,
+		UserID:    job.UserID,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		LastError: job.LastError,
+		RunAfter:  job.RunAfter,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+		Items:     items,
+	}
+}
+
+func (m *DeleteJobFileModel) toDomain() *domain.DeleteJob {
+	items := make([]domain.DeleteJobItem, len(m.Items))
+	for i, item := range m.Items {
+		items[i] = domain.DeleteJobItem{ShortURL: item.ShortURL, Status: item.Status}
+	}
+	return &domain.DeleteJob{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Status:    m.Status,
+		Attempts:  m.Attempts,
+		LastError: m.LastError,
+		RunAfter:  m.RunAfter,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+		Items:     items,
+	}
+}
+
+func deleteJobsFileName(fileName string) string {
+	return fileName + ".jobs"
+}
+
+type DeleteJobFileWriter struct {
+	*jsonLinesWriter
+}
+
+func NewDeleteJobFileWriter(filename string, policy string) (*DeleteJobFileWriter, error) {
+	writer, err := openJSONLinesWriter(filename, policy, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &DeleteJobFileWriter{jsonLinesWriter: writer}, nil
+}
+
+// WriteJob сразу отдаёт запись ОС, чтобы принятая задача пережила падение процесса;
+// fsync — по политике SyncPolicy.
+func (d *DeleteJobFileWriter) WriteJob(job *DeleteJobFileModel) error {
+	if err := d.write(job); err != nil {
+		return err
+	}
+	return d.flush()
+}
+
+// Records возвращает число снимков в файле, включая устаревшие.
+func (d *DeleteJobFileWriter) Records() int {
+	return d.records
+}
+
+// Compact оставляет в файле по одному снимку на задачу.
+func (d *DeleteJobFileWriter) Compact(jobs []*DeleteJobFileModel) error {
+	snapshot := make([]any, len(jobs))
+	for i, job := range jobs {
+		snapshot[i] = job
+	}
+	return d.compact(snapshot)
+}
+
+func (d *DeleteJobFileWriter) Sync() error {
+	return d.sync()
+}
+
+func (d *DeleteJobFileWriter) Close() error {
+	return d.close()
+}
+
+// ReadDeleteJobFile возвращает снимки задач в порядке записи.
+func ReadDeleteJobFile(filename string) ([]DeleteJobFileModel, error) {
+	var jobs []DeleteJobFileModel
+	_, err := replayJSONLines(filename, func(job DeleteJobFileModel) {
+		jobs = append(jobs, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
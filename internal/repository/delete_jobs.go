@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// deleteJobRetention — сколько завершённые задачи остаются доступны для GET по ID.
+const deleteJobRetention = 24 * time.Hour
+
+// deleteJobQueue — очередь задач удаления в памяти процесса.
+// Используется RAM хранилищем напрямую и файловым хранилищем поверх журнала.
+type deleteJobQueue struct {
+	mu   sync.Mutex
+	jobs map[string]*domain.DeleteJob
+}
+
+func newDeleteJobQueue() *deleteJobQueue {
+	return &deleteJobQueue{jobs: make(map[string]*domain.DeleteJob)}
+}
+
+func (q *deleteJobQueue) put(job *domain.DeleteJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.jobs[job.ID] = copyDeleteJob(job)
+}
+
+// claim заодно забывает задачи, завершённые раньше чем deleteJobRetention назад.
+func (q *deleteJobQueue) claim(now time.Time, lease time.Duration) *domain.DeleteJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, job := range q.jobs {
+		isFinished := job.Status == domain.DeleteJobDone || job.Status == domain.DeleteJobFailed
+		if isFinished && job.UpdatedAt.Before(now.Add(-deleteJobRetention)) {
+			delete(q.jobs, id)
+		}
+	}
+
+	var candidates []*domain.DeleteJob
+	for _, job := range q.jobs {
+		isActive := job.Status == domain.DeleteJobPending || job.Status == domain.DeleteJobRunning
+		if isActive && !job.RunAfter.After(now) {
+			candidates = append(candidates, job)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+
+	job := candidates[0]
+	job.Status = domain.DeleteJobRunning
+	job.Attempts++
+	job.RunAfter = now.Add(lease)
+	job.UpdatedAt = now
+	return copyDeleteJob(job)
+}
+
+func (q *deleteJobQueue) countActive() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var count int64
+	for _, job := range q.jobs {
+		if job.Status == domain.DeleteJobPending || job.Status == domain.DeleteJobRunning {
+			count++
+		}
+	}
+	return count
+}
+
+func (q *deleteJobQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.jobs)
+}
+
+func (q *deleteJobQueue) snapshot() []*domain.DeleteJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]*domain.DeleteJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, copyDeleteJob(job))
+	}
+	return jobs
+}
+
+func (q *deleteJobQueue) get(id string) (*domain.DeleteJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, exists := q.jobs[id]
+	if !exists {
+		return nil, errs.ErrJobNotFound
+	}
+	return copyDeleteJob(job), nil
+}
+
+func copyDeleteJob(job *domain.DeleteJob) *domain.DeleteJob {
+	jobCopy := *job
+	jobCopy.Items = append([]domain.DeleteJobItem(nil), job.Items...)
+	return &jobCopy
+}
@@ -1,71 +1,209 @@
 package repository
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
-	"errors"
 	"github.com/pervukhinpm/link-shortener.git/domain"
 	"github.com/pervukhinpm/link-shortener.git/internal/errs"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
 	"github.com/pervukhinpm/link-shortener.git/internal/utils"
-	"os"
+	"sync"
+	"time"
 )
 
 type FileRepository struct {
-	fileName string
-	storage  map[string]URLFileModel
-	writer   URLFileWriter
-	reader   URLFileReader
+	fileName    string
+	dedupeScope string
+	options     FileRepositoryOptions
+	// mu защищает storage и порядок записей в журнале
+	mu           sync.RWMutex
+	storage      map[string]URLFileModel
+	journal      *URLJournal
+	stopSync     chan struct{}
+	syncDone     chan struct{}
+	clicksMu     sync.Mutex
+	clicks       map[string][]domain.Click
+	clicksWriter *ClickFileWriter
+	jobsMu       sync.Mutex
+	deleteJobs   *deleteJobQueue
+	jobsWriter   *DeleteJobFileWriter
+	apiKeysMu    sync.Mutex
+	apiKeys      *apiKeyStore
+	keysWriter   *APIKeyFileWriter
 }
 
 func (r *FileRepository) Close() error {
-	return r.reader.Close()
+	if r.stopSync != nil {
+		close(r.stopSync)
+		<-r.syncDone
+	}
+	if err := r.clicksWriter.Close(); err != nil {
+		return err
+	}
+	if err := r.jobsWriter.Close(); err != nil {
+		return err
+	}
+	if err := r.keysWriter.Close(); err != nil {
+		return err
+	}
+	return r.journal.Close()
 }
 
-func NewFileRepository(fileName string) (*FileRepository, error) {
-	writer, err := NewURLFileWriter(fileName)
+func NewFileRepository(fileName string, dedupeScope string, options FileRepositoryOptions) (*FileRepository, error) {
+	if err := validateDedupeScope(dedupeScope); err != nil {
+		return nil, err
+	}
+
+	storage, records, err := ReplayURLJournal(fileName)
 	if err != nil {
 		return nil, err
 	}
 
-	reader, err := NewURLFileReader(fileName)
+	journal, err := OpenURLJournal(fileName, options.SyncPolicy)
 	if err != nil {
 		return nil, err
 	}
+	journal.records = records
 
-	err = reader.ReadURL()
+	clickModels, err := ReadClickFile(clicksFileName(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	clicksWriter, err := NewClickFileWriter(clicksFileName(fileName), options.SyncPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	jobModels, err := ReadDeleteJobFile(deleteJobsFileName(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	jobsWriter, err := NewDeleteJobFileWriter(deleteJobsFileName(fileName), options.SyncPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	keyModels, err := ReadAPIKeyFile(apiKeysFileName(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	keysWriter, err := NewAPIKeyFileWriter(apiKeysFileName(fileName), options.SyncPolicy)
 	if err != nil {
 		return nil, err
 	}
 
 	repository := &FileRepository{
-		fileName,
-		make(map[string]URLFileModel),
-		*writer,
-		*reader,
+		fileName:     fileName,
+		dedupeScope:  dedupeScope,
+		options:      options,
+		storage:      storage,
+		journal:      journal,
+		clicks:       make(map[string][]domain.Click),
+		clicksWriter: clicksWriter,
+		deleteJobs:   newDeleteJobQueue(),
+		jobsWriter:   jobsWriter,
+		apiKeys:      newAPIKeyStore(),
+		keysWriter:   keysWriter,
 	}
 
-	for _, v := range reader.URLFileModels {
-		repository.storage[v.ShortURL] = v
+	for _, v := range jobModels {
+		repository.deleteJobs.put(v.toDomain())
+	}
+	jobsWriter.records = len(jobModels)
+
+	for _, v := range keyModels {
+		repository.apiKeys.put(v.toDomain())
+	}
+
+	for _, v := range clickModels {
+		repository.clicks[v.ShortURL] = append(repository.clicks[v.ShortURL], v.toDomain())
+	}
+
+	if err := repository.maybeCompact(); err != nil {
+		return nil, err
+	}
+	if err := repository.maybeCompactDeleteJobs(); err != nil {
+		return nil, err
 	}
 
-	reader.Close()
+	if options.SyncPolicy == SyncInterval && options.SyncInterval > 0 {
+		repository.stopSync = make(chan struct{})
+		repository.syncDone = make(chan struct{})
+		go repository.runSync()
+	}
 
 	return repository, nil
 }
 
+func (r *FileRepository) runSync() {
+	defer close(r.syncDone)
+
+	ticker := time.NewTicker(r.options.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopSync:
+			return
+		case <-ticker.C:
+			if err := r.journal.Sync(); err != nil {
+				middleware.Log.Errorw("Failed to sync URL journal", "error", err)
+			}
+			r.clicksMu.Lock()
+			err := r.clicksWriter.Sync()
+			r.clicksMu.Unlock()
+			if err != nil {
+				middleware.Log.Errorw("Failed to sync click log", "error", err)
+			}
+			r.jobsMu.Lock()
+			err = r.jobsWriter.Sync()
+			r.jobsMu.Unlock()
+			if err != nil {
+				middleware.Log.Errorw("Failed to sync delete job log", "error", err)
+			}
+			r.apiKeysMu.Lock()
+			err = r.keysWriter.Sync()
+			r.apiKeysMu.Unlock()
+			if err != nil {
+				middleware.Log.Errorw("Failed to sync api key log", "error", err)
+			}
+		}
+	}
+}
+
 func (r *FileRepository) Add(url *domain.URL, ctx context.Context) error {
-	existingURL, _ := r.Get(url.ID, ctx)
-	if existingURL != nil {
-		return errs.NewOriginalURLAlreadyExists(existingURL)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.add(url)
+}
+
+func (r *FileRepository) add(url *domain.URL) error {
+	now := time.Now()
+	for _, existingURL := range r.storage {
+		if blocksDedupe(existingURL.IsDeleted, existingURL.ExpiresAt, now) && isDuplicate(r.dedupeScope, existingURL.UserID, canonicalOrOriginal(existingURL.CanonicalURL, existingURL.OriginalURL),
+			url.UserID, canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)) {
+			return errs.NewOriginalURLAlreadyExists(
+				domain.NewURL(existingURL.ShortURL, existingURL.OriginalURL, existingURL.UserID, existingURL.IsDeleted),
+			)
+		}
+	}
+
+	if _, exists := r.storage[url.ID]; exists {
+		return errs.NewShortURLAlreadyExists(url.ID)
 	}
 	uuid, err := utils.GenerateUUID()
 	if err != nil {
 		return err
 	}
-	urlFileModel := NewURLFileModel(uuid, url.ID, url.OriginalURL, false)
-	err = r.writer.WriteURL(urlFileModel)
+	urlFileModel := NewURLFileModel(uuid, url.ID, url.OriginalURL, url.UserID, false)
+	urlFileModel.ExpiresAt = url.ExpiresAt
+	urlFileModel.CreatedAt = ensureCreatedAt(url)
+	urlFileModel.Tags = url.Tags
+	urlFileModel.CanonicalURL = url.CanonicalURL
+	err = r.journal.Append(URLJournalRecord{Op: JournalOpCreate, URLFileModel: *urlFileModel})
 	if err != nil {
 		return err
 	}
@@ -73,157 +211,334 @@ func (r *FileRepository) Add(url *domain.URL, ctx context.Context) error {
 	return nil
 }
 
-func (r *FileRepository) AddBatch(urls []domain.URL, ctx context.Context) error {
-	for _, url := range urls {
-		if err := r.Add(&url, ctx); err != nil {
-			return err
+func (r *FileRepository) AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]BatchItemResult, len(urls))
+	for i, url := range urls {
+		result, err := newBatchItemResult(url.ID, r.add(&url))
+		if err != nil {
+			return nil, err
 		}
+		results[i] = result
 	}
-	return nil
+	return results, nil
 }
 
 func (r *FileRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
-	userID := middleware.GetUserID(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	url, exists := r.storage[id]
 	if !exists {
-		return nil, errors.New("URL not found")
+		return nil, errs.ErrURLNotFound
 	}
-	return domain.NewURL(id, url.OriginalURL, userID, url.IsDeleted), nil
+	result := domain.NewURL(id, url.OriginalURL, url.UserID, url.IsDeleted)
+	result.ExpiresAt = url.ExpiresAt
+	result.CreatedAt = url.CreatedAt
+	result.Tags = url.Tags
+	result.CanonicalURL = url.CanonicalURL
+	return result, nil
 }
 
-func (r *FileRepository) GetByUserID(ctx context.Context) (*[]domain.URL, error) {
-	var urls []domain.URL
+func (r *FileRepository) Update(_ context.Context, url *domain.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	userID := middleware.GetUserID(ctx)
+	storedURL, exists := r.storage[url.ID]
+	if !exists || storedURL.UserID != url.UserID {
+		return errs.ErrURLNotFound
+	}
 
+	now := time.Now()
+	for _, existingURL := range r.storage {
+		if existingURL.ShortURL != url.ID && blocksDedupe(existingURL.IsDeleted, existingURL.ExpiresAt, now) && isDuplicate(r.dedupeScope, existingURL.UserID, canonicalOrOriginal(existingURL.CanonicalURL, existingURL.OriginalURL),
+			url.UserID, canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)) {
+			return errs.NewOriginalURLAlreadyExists(
+				domain.NewURL(existingURL.ShortURL, existingURL.OriginalURL, existingURL.UserID, existingURL.IsDeleted),
+			)
+		}
+	}
+
+	storedURL.OriginalURL = url.OriginalURL
+	storedURL.CanonicalURL = url.CanonicalURL
+	storedURL.ExpiresAt = url.ExpiresAt
+	storedURL.Tags = url.Tags
+	if err := r.journal.Append(URLJournalRecord{Op: JournalOpUpdate, URLFileModel: storedURL}); err != nil {
+		return err
+	}
+	r.storage[url.ID] = storedURL
+	return r.maybeCompact()
+}
+
+func (r *FileRepository) GetURLsPage(ctx context.Context, query URLPageQuery) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var urls []domain.URL
 	for _, record := range r.storage {
-		if record.UserID == userID {
+		if record.UserID == query.UserID {
 			url := domain.NewURL(record.ShortURL, record.OriginalURL, record.UserID, record.IsDeleted)
+			url.ExpiresAt = record.ExpiresAt
+			url.CreatedAt = record.CreatedAt
+			url.Tags = record.Tags
+			url.CanonicalURL = record.CanonicalURL
 			urls = append(urls, *url)
 		}
 	}
+	return pageURLs(urls, query), nil
+}
+
+func (r *FileRepository) GetTags(ctx context.Context, userID string) ([]domain.TagCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counter := tagCounter{}
+	for _, record := range r.storage {
+		if record.UserID == userID {
+			counter.add(&domain.URL{IsDeleted: record.IsDeleted, Tags: record.Tags})
+		}
+	}
+	return counter.result(), nil
+}
+
+func (r *FileRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sourceSet := tagSet(sources)
+	var records []URLJournalRecord
+	for _, record := range r.storage {
+		if record.UserID != userID {
+			continue
+		}
+		if tags, changed := mergeTagList(record.Tags, sourceSet, target); changed {
+			record.Tags = tags
+			records = append(records, URLJournalRecord{Op: JournalOpUpdate, URLFileModel: record})
+		}
+	}
+	if len(records) == 0 {
+		return errs.ErrTagNotFound
+	}
 
-	// Если ничего не найдено, возвращаем пустой список
-	return &urls, nil
+	if err := r.journal.Append(records...); err != nil {
+		return err
+	}
+	for _, record := range records {
+		applyJournalRecord(r.storage, record)
+	}
+	return r.maybeCompact()
 }
 
-func (r *FileRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) error {
-	userID := middleware.GetUserID(ctx)
+func (r *FileRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	var deleted []string
+	var records []URLJournalRecord
 	for _, url := range urls {
 		storedURL, exists := r.storage[url.ShortURL]
-		if exists && storedURL.UserID == userID {
-			storedURL.IsDeleted = true
-			r.storage[url.ShortURL] = storedURL
+		if exists && storedURL.UserID == url.UserID {
+			deleted = append(deleted, url.ShortURL)
+			records = append(records, newDeleteJournalRecord(storedURL))
 		}
 	}
 
-	return r.rewriteFile()
+	if err := r.applyDeletes(records); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func (r *FileRepository) AddDeleteJob(_ context.Context, job *domain.DeleteJob) error {
+	return r.saveDeleteJob(job)
+}
+
+func (r *FileRepository) ClaimDeleteJob(_ context.Context, now time.Time, lease time.Duration) (*domain.DeleteJob, error) {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+
+	job := r.deleteJobs.claim(now, lease)
+	if job != nil {
+		if err := r.jobsWriter.WriteJob(NewDeleteJobFileModel(job)); err != nil {
+			return nil, err
+		}
+	}
+	// claim мог забыть старые завершённые задачи — их снимки тоже устаревшие
+	if err := r.maybeCompactDeleteJobs(); err != nil {
+		return nil, err
+	}
+	return job, nil
 }
 
-func (r *FileRepository) GetFlagByShortURL(_ context.Context, shortenedURL string) (bool, error) {
-	return r.storage[shortenedURL].IsDeleted, nil
+func (r *FileRepository) SaveDeleteJob(_ context.Context, job *domain.DeleteJob) error {
+	return r.saveDeleteJob(job)
 }
 
-func (r *FileRepository) rewriteFile() error {
-	fileWriter, err := NewURLFileWriter(r.fileName)
-	if err != nil {
+func (r *FileRepository) CountActiveDeleteJobs(_ context.Context) (int64, error) {
+	return r.deleteJobs.countActive(), nil
+}
+
+func (r *FileRepository) GetDeleteJob(_ context.Context, id string) (*domain.DeleteJob, error) {
+	return r.deleteJobs.get(id)
+}
+
+func (r *FileRepository) saveDeleteJob(job *domain.DeleteJob) error {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+
+	if err := r.jobsWriter.WriteJob(NewDeleteJobFileModel(job)); err != nil {
 		return err
 	}
-	defer fileWriter.file.Close()
+	r.deleteJobs.put(job)
+	return r.maybeCompactDeleteJobs()
+}
 
-	for _, urlModel := range r.storage {
-		err := fileWriter.WriteURL(&urlModel)
-		if err != nil {
-			return err
-		}
+// maybeCompactDeleteJobs — то же, что maybeCompact, для журнала задач удаления; вызывается под jobsMu
+// или до запуска репозитория.
+func (r *FileRepository) maybeCompactDeleteJobs() error {
+	if r.options.CompactAfter <= 0 || r.jobsWriter.Records()-r.deleteJobs.len() <= r.options.CompactAfter {
+		return nil
 	}
 
-	return nil
+	jobs := r.deleteJobs.snapshot()
+	models := make([]*DeleteJobFileModel, len(jobs))
+	for i, job := range jobs {
+		models[i] = NewDeleteJobFileModel(job)
+	}
+	return r.jobsWriter.Compact(models)
 }
 
-type URLFileModel struct {
-	UUID        string `json:"uuid"`
-	UserID      string `json:"user_uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	IsDeleted   bool   `json:"is_deleted"`
+func (r *FileRepository) DeleteExpired(_ context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []URLJournalRecord
+	for _, storedURL := range r.storage {
+		if storedURL.IsDeleted || storedURL.ExpiresAt == nil || now.Before(*storedURL.ExpiresAt) {
+			continue
+		}
+		records = append(records, newDeleteJournalRecord(storedURL))
+	}
+
+	if err := r.applyDeletes(records); err != nil {
+		return 0, err
+	}
+	return int64(len(records)), nil
 }
 
-func NewURLFileModel(uuid, shortURL, originalURL string, isDeleted bool) *URLFileModel {
-	return &URLFileModel{
-		UUID:        uuid,
-		ShortURL:    shortURL,
-		OriginalURL: originalURL,
-		IsDeleted:   isDeleted,
+func (r *FileRepository) AddClicks(_ context.Context, clicks []domain.Click) error {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+
+	for _, click := range clicks {
+		if err := r.clicksWriter.WriteClick(NewClickFileModel(click)); err != nil {
+			return err
+		}
+		r.clicks[click.ShortURL] = append(r.clicks[click.ShortURL], click)
 	}
+	return r.clicksWriter.Flush()
 }
 
-type URLFileWriter struct {
-	file   *os.File
-	writer *bufio.Writer
+func (r *FileRepository) GetClickStats(_ context.Context, shortURL string) (*domain.ClickStats, error) {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+
+	return aggregateClicks(shortURL, r.clicks[shortURL]), nil
 }
 
-func NewURLFileWriter(filename string) (*URLFileWriter, error) {
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return nil, err
+func (r *FileRepository) AddAPIKey(_ context.Context, key *domain.APIKey) error {
+	r.apiKeysMu.Lock()
+	defer r.apiKeysMu.Unlock()
+
+	if err := r.keysWriter.WriteAPIKey(NewAPIKeyFileModel(key)); err != nil {
+		return err
 	}
-	return &URLFileWriter{
-		file:   file,
-		writer: bufio.NewWriter(file),
-	}, nil
+	r.apiKeys.put(*key)
+	return nil
+}
+
+func (r *FileRepository) GetAPIKeyByHash(_ context.Context, keyHash string) (*domain.APIKey, error) {
+	return r.apiKeys.getByHash(keyHash)
+}
+
+func (r *FileRepository) GetAPIKeysByUser(_ context.Context, userID string) ([]domain.APIKey, error) {
+	return r.apiKeys.getByUser(userID), nil
 }
 
-func (u *URLFileWriter) WriteURL(fu *URLFileModel) error {
-	data, err := json.Marshal(&fu)
+func (r *FileRepository) RevokeAPIKey(_ context.Context, userID, id string, revokedAt time.Time) error {
+	r.apiKeysMu.Lock()
+	defer r.apiKeysMu.Unlock()
+
+	key, err := r.apiKeys.revoke(userID, id, revokedAt)
 	if err != nil {
 		return err
 	}
-	if _, err := u.writer.Write(data); err != nil {
-		return err
+	return r.keysWriter.WriteAPIKey(NewAPIKeyFileModel(key))
+}
+
+// applyDeletes сначала пишет записи в журнал и только потом меняет состояние в памяти,
+// чтобы после сбоя не потерять подтверждённое удаление; вызывается под r.mu.
+func (r *FileRepository) applyDeletes(records []URLJournalRecord) error {
+	if len(records) == 0 {
+		return nil
 	}
-	if err := u.writer.WriteByte('\n'); err != nil {
+	if err := r.journal.Append(records...); err != nil {
 		return err
 	}
-	return u.writer.Flush()
+	for _, record := range records {
+		applyJournalRecord(r.storage, record)
+	}
+	return r.maybeCompact()
 }
 
-type URLFileReader struct {
-	file          *os.File
-	scanner       *bufio.Scanner
-	URLFileModels []URLFileModel
-}
+// maybeCompact переписывает журнал, когда устаревших записей становится больше CompactAfter;
+// вызывается под r.mu.
+func (r *FileRepository) maybeCompact() error {
+	if r.options.CompactAfter <= 0 || r.journal.Records()-len(r.storage) <= r.options.CompactAfter {
+		return nil
+	}
 
-func NewURLFileReader(filename string) (*URLFileReader, error) {
-	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return nil, err
+	snapshot := make([]URLFileModel, 0, len(r.storage))
+	for _, model := range r.storage {
+		snapshot = append(snapshot, model)
 	}
-	return &URLFileReader{
-		file:          file,
-		scanner:       bufio.NewScanner(file),
-		URLFileModels: nil,
-	}, nil
+	return r.journal.Compact(snapshot)
 }
 
-func (u *URLFileReader) ReadURL() error {
-	u.URLFileModels = []URLFileModel{}
-	for u.scanner.Scan() {
-		data := u.scanner.Bytes()
-		tempFormed := URLFileModel{}
-		err := json.Unmarshal(data, &tempFormed)
-		if err != nil {
-			return err
-		}
-		u.URLFileModels = append(u.URLFileModels, tempFormed)
+func newDeleteJournalRecord(stored URLFileModel) URLJournalRecord {
+	return URLJournalRecord{
+		Op: JournalOpDelete,
+		URLFileModel: URLFileModel{
+			UUID:      stored.UUID,
+			UserID:    stored.UserID,
+			ShortURL:  stored.ShortURL,
+			IsDeleted: true,
+		},
 	}
-	if err := u.scanner.Err(); err != nil {
-		return u.scanner.Err()
-	}
-	return nil
 }
 
-func (u *URLFileReader) Close() error {
-	return u.file.Close()
+type URLFileModel struct {
+	UUID        string     `json:"uuid"`
+	UserID      string     `json:"user_uuid"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	IsDeleted   bool       `json:"is_deleted"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// CreatedAt у записей, созданных до появления поля, нулевой.
+	CreatedAt time.Time `json:"created_at"`
+	Tags      []string  `json:"tags,omitempty"`
+	// CanonicalURL пуст у записей, созданных до появления канонизации.
+	CanonicalURL string `json:"canonical_url,omitempty"`
+}
+
+func NewURLFileModel(uuid, shortURL, originalURL, userID string, isDeleted bool) *URLFileModel {
+	return &URLFileModel{
+		UUID:        uuid,
+		UserID:      userID,
+		ShortURL:    shortURL,
+		OriginalURL: originalURL,
+		IsDeleted:   isDeleted,
+	}
 }
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/metrics"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+// InstrumentedRepository замеряет длительность каждой операции хранилища и открывает для неё спан.
+type InstrumentedRepository struct {
+	repo    Repository
+	backend string
+}
+
+func NewInstrumentedRepository(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{repo: repo, backend: BackendName(repo)}
+}
+
+// BackendName возвращает метку хранилища для метрик.
+func BackendName(repo Repository) string {
+	switch repo.(type) {
+	case *DatabaseRepository:
+		return "postgres"
+	case *SQLiteRepository:
+		return "sqlite"
+	case *FileRepository:
+		return "file"
+	case *RAMRepository:
+		return "ram"
+	default:
+		return "unknown"
+	}
+}
+
+// start открывает спан операции; возвращённая функция закрывает его и записывает длительность.
+func (ir *InstrumentedRepository) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "repository."+operation, attribute.String("db.system", ir.backend))
+	return ctx, func(err error) {
+		metrics.RepositoryOperationDuration.WithLabelValues(ir.backend, operation).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}
+}
+
+func (ir *InstrumentedRepository) Add(url *domain.URL, ctx context.Context) (err error) {
+	ctx, finish := ir.start(ctx, "add")
+	defer func() { finish(err) }()
+	return ir.repo.Add(url, ctx)
+}
+
+func (ir *InstrumentedRepository) AddBatch(urls []domain.URL, ctx context.Context) (_ []BatchItemResult, err error) {
+	ctx, finish := ir.start(ctx, "add_batch")
+	defer func() { finish(err) }()
+	return ir.repo.AddBatch(urls, ctx)
+}
+
+func (ir *InstrumentedRepository) Get(id string, ctx context.Context) (_ *domain.URL, err error) {
+	ctx, finish := ir.start(ctx, "get")
+	defer func() { finish(err) }()
+	return ir.repo.Get(id, ctx)
+}
+
+func (ir *InstrumentedRepository) Update(ctx context.Context, url *domain.URL) (err error) {
+	ctx, finish := ir.start(ctx, "update")
+	defer func() { finish(err) }()
+	return ir.repo.Update(ctx, url)
+}
+
+func (ir *InstrumentedRepository) GetURLsPage(ctx context.Context, query URLPageQuery) (_ []domain.URL, err error) {
+	ctx, finish := ir.start(ctx, "get_urls_page")
+	defer func() { finish(err) }()
+	return ir.repo.GetURLsPage(ctx, query)
+}
+
+func (ir *InstrumentedRepository) GetTags(ctx context.Context, userID string) (_ []domain.TagCount, err error) {
+	ctx, finish := ir.start(ctx, "get_tags")
+	defer func() { finish(err) }()
+	return ir.repo.GetTags(ctx, userID)
+}
+
+func (ir *InstrumentedRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) (err error) {
+	ctx, finish := ir.start(ctx, "merge_tags")
+	defer func() { finish(err) }()
+	return ir.repo.MergeTags(ctx, userID, sources, target)
+}
+
+func (ir *InstrumentedRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) (_ []string, err error) {
+	ctx, finish := ir.start(ctx, "delete_url_batch")
+	defer func() { finish(err) }()
+	return ir.repo.DeleteURLBatch(ctx, urls)
+}
+
+func (ir *InstrumentedRepository) DeleteExpired(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, finish := ir.start(ctx, "delete_expired")
+	defer func() { finish(err) }()
+	return ir.repo.DeleteExpired(ctx, now)
+}
+
+func (ir *InstrumentedRepository) AddClicks(ctx context.Context, clicks []domain.Click) (err error) {
+	ctx, finish := ir.start(ctx, "add_clicks")
+	defer func() { finish(err) }()
+	return ir.repo.AddClicks(ctx, clicks)
+}
+
+func (ir *InstrumentedRepository) GetClickStats(ctx context.Context, shortURL string) (_ *domain.ClickStats, err error) {
+	ctx, finish := ir.start(ctx, "get_click_stats")
+	defer func() { finish(err) }()
+	return ir.repo.GetClickStats(ctx, shortURL)
+}
+
+func (ir *InstrumentedRepository) AddDeleteJob(ctx context.Context, job *domain.DeleteJob) (err error) {
+	ctx, finish := ir.start(ctx, "add_delete_job")
+	defer func() { finish(err) }()
+	return ir.repo.AddDeleteJob(ctx, job)
+}
+
+func (ir *InstrumentedRepository) ClaimDeleteJob(ctx context.Context, now time.Time, lease time.Duration) (_ *domain.DeleteJob, err error) {
+	ctx, finish := ir.start(ctx, "claim_delete_job")
+	defer func() { finish(err) }()
+	return ir.repo.ClaimDeleteJob(ctx, now, lease)
+}
+
+func (ir *InstrumentedRepository) SaveDeleteJob(ctx context.Context, job *domain.DeleteJob) (err error) {
+	ctx, finish := ir.start(ctx, "save_delete_job")
+	defer func() { finish(err) }()
+	return ir.repo.SaveDeleteJob(ctx, job)
+}
+
+func (ir *InstrumentedRepository) GetDeleteJob(ctx context.Context, id string) (_ *domain.DeleteJob, err error) {
+	ctx, finish := ir.start(ctx, "get_delete_job")
+	defer func() { finish(err) }()
+	return ir.repo.GetDeleteJob(ctx, id)
+}
+
+func (ir *InstrumentedRepository) CountActiveDeleteJobs(ctx context.Context) (_ int64, err error) {
+	ctx, finish := ir.start(ctx, "count_active_delete_jobs")
+	defer func() { finish(err) }()
+	return ir.repo.CountActiveDeleteJobs(ctx)
+}
+
+func (ir *InstrumentedRepository) AddAPIKey(ctx context.Context, key *domain.APIKey) (err error) {
+	ctx, finish := ir.start(ctx, "add_api_key")
+	defer func() { finish(err) }()
+	return ir.repo.AddAPIKey(ctx, key)
+}
+
+func (ir *InstrumentedRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (_ *domain.APIKey, err error) {
+	ctx, finish := ir.start(ctx, "get_api_key_by_hash")
+	defer func() { finish(err) }()
+	return ir.repo.GetAPIKeyByHash(ctx, keyHash)
+}
+
+func (ir *InstrumentedRepository) GetAPIKeysByUser(ctx context.Context, userID string) (_ []domain.APIKey, err error) {
+	ctx, finish := ir.start(ctx, "get_api_keys_by_user")
+	defer func() { finish(err) }()
+	return ir.repo.GetAPIKeysByUser(ctx, userID)
+}
+
+func (ir *InstrumentedRepository) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (err error) {
+	ctx, finish := ir.start(ctx, "revoke_api_key")
+	defer func() { finish(err) }()
+	return ir.repo.RevokeAPIKey(ctx, userID, id, revokedAt)
+}
+
+func (ir *InstrumentedRepository) Close() error {
+	return ir.repo.Close()
+}
+
+// RegisterCacheMetrics публикует счётчики кеша редиректов.
+func RegisterCacheMetrics(cache *CachedRepository) {
+	counter := func(name, help string, value func(stats CacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "shortener",
+			Subsystem: "cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(cache.Stats()))
+		})
+	}
+
+	prometheus.MustRegister(
+		counter("hits_total", "Redirect lookups served from cache.",
+			func(stats CacheStats) uint64 { return stats.Hits }),
+		counter("negative_hits_total", "Lookups of unknown short IDs served from cache.",
+			func(stats CacheStats) uint64 { return stats.NegativeHits }),
+		counter("misses_total", "Lookups that went to the storage backend.",
+			func(stats CacheStats) uint64 { return stats.Misses }),
+		counter("evictions_total", "Entries evicted to stay within cache size.",
+			func(stats CacheStats) uint64 { return stats.Evictions }),
+	)
+}
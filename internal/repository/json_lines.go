@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// replayJSONLines читает файл построчно и передаёт каждую запись в apply; возвращает
+// число прочитанных записей. Недописанная последняя строка (сбой посреди записи)
+// отрезается, повреждение в середине — ошибка.
+func replayJSONLines[T any](path string, apply func(T)) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	var records int
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return 0, readErr
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if readErr != nil {
+				break
+			}
+			offset += int64(len(line))
+			continue
+		}
+
+		var record T
+		err := json.Unmarshal(line, &record)
+		complete := readErr == nil
+		if err != nil || !complete {
+			if _, peekErr := reader.Peek(1); complete && peekErr == nil {
+				return 0, fmt.Errorf("%s:%d: corrupted record: %w", path, lineNumber, err)
+			}
+			middleware.Log.Warnw("Truncating incomplete last record", "path", path, "line", lineNumber)
+			if err := file.Truncate(offset); err != nil {
+				return 0, err
+			}
+			break
+		}
+
+		apply(record)
+		records++
+		offset += int64(len(line))
+	}
+
+	return records, nil
+}
+
+// syncDir фиксирует переименование файла в каталоге.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// jsonLinesWriter дописывает записи в файл и сбрасывает их на диск по политике SyncPolicy.
+type jsonLinesWriter struct {
+	path   string
+	perm   os.FileMode
+	policy string
+	file   *os.File
+	writer *bufio.Writer
+	// records — число записей в файле, включая устаревшие; задаётся после чтения файла.
+	records int
+}
+
+func openJSONLinesWriter(path string, policy string, perm os.FileMode) (*jsonLinesWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesWriter{
+		path:   path,
+		perm:   perm,
+		policy: policy,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// write только буферизует запись, на диск она попадает при flush.
+func (w *jsonLinesWriter) write(record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		return err
+	}
+	if err := w.writer.WriteByte('\n'); err != nil {
+		return err
+	}
+	w.records++
+	return nil
+}
+
+// flush отдаёт буфер ОС, а с политикой always ещё и делает fsync.
+func (w *jsonLinesWriter) flush() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if w.policy == SyncAlways {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *jsonLinesWriter) sync() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *jsonLinesWriter) close() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if w.policy != SyncNever {
+		if err := w.file.Sync(); err != nil {
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+// compact заменяет содержимое файла записями snapshot. Снимок пишется во временный файл
+// рядом и атомарно переименовывается, так что при сбое на диске остаётся либо старый,
+// либо новый файл целиком.
+func (w *jsonLinesWriter) compact(snapshot []any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, record := range snapshot {
+		data, err := json.Marshal(record)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(w.perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(w.path)); err != nil {
+		return err
+	}
+
+	// Старый дескриптор указывает на удалённый файл, дальше пишем в новый
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, w.perm)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	w.records = len(snapshot)
+	return nil
+}
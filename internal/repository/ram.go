@@ -2,89 +2,171 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"github.com/pervukhinpm/link-shortener.git/domain"
 	"github.com/pervukhinpm/link-shortener.git/internal/errs"
-	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"sync"
+	"time"
 )
 
 type RAMRepository struct {
+	// mu защищает MapURL: к нему одновременно обращаются HTTP-обработчики и фоновые воркеры
+	mu     sync.RWMutex
 	MapURL map[string]domain.URL
+	// clicks пишутся фоновым ClickRecorder, поэтому защищены отдельным мьютексом
+	clicksMu   sync.Mutex
+	clicks     map[string][]domain.Click
+	deleteJobs *deleteJobQueue
+	apiKeys    *apiKeyStore
+	// dedupeScope — DedupeGlobal, DedupeUser или DedupeNone
+	dedupeScope string
 }
 
-func NewRAMRepository() (*RAMRepository, error) {
-	return &RAMRepository{MapURL: make(map[string]domain.URL)}, nil
+func NewRAMRepository(dedupeScope string) (*RAMRepository, error) {
+	if err := validateDedupeScope(dedupeScope); err != nil {
+		return nil, err
+	}
+	return &RAMRepository{
+		dedupeScope: dedupeScope,
+		MapURL:      make(map[string]domain.URL),
+		clicks:      make(map[string][]domain.Click),
+		deleteJobs:  newDeleteJobQueue(),
+		apiKeys:     newAPIKeyStore(),
+	}, nil
 }
 
 func (rmr *RAMRepository) Add(url *domain.URL, ctx context.Context) error {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
+
+	return rmr.add(url)
+}
+
+func (rmr *RAMRepository) add(url *domain.URL) error {
+	now := time.Now()
 	for _, existingURL := range rmr.MapURL {
-		if existingURL.OriginalURL == url.OriginalURL {
-			return errs.NewOriginalURLAlreadyExists(url)
+		if blocksDedupe(existingURL.IsDeleted, existingURL.ExpiresAt, now) && isDuplicate(rmr.dedupeScope, existingURL.UserID, canonicalOrOriginal(existingURL.CanonicalURL, existingURL.OriginalURL),
+			url.UserID, canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)) {
+			return errs.NewOriginalURLAlreadyExists(&existingURL)
 		}
 	}
 
+	if _, exists := rmr.MapURL[url.ID]; exists {
+		return errs.NewShortURLAlreadyExists(url.ID)
+	}
+
+	ensureCreatedAt(url)
 	rmr.MapURL[url.ID] = *url
 	return nil
 }
 
 func (rmr *RAMRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
-	longURL := rmr.MapURL[id].OriginalURL
-	userID := middleware.GetUserID(ctx)
-	isDeleted := rmr.MapURL[id].IsDeleted
-	if longURL == "" {
-		return nil, errors.New("url not found")
+	rmr.mu.RLock()
+	defer rmr.mu.RUnlock()
+
+	storedURL, exists := rmr.MapURL[id]
+	if !exists {
+		return nil, errs.ErrURLNotFound
 	}
-	url := domain.NewURL(id, longURL, userID, isDeleted)
-	return url, nil
+	return &storedURL, nil
 }
 
-func (rmr *RAMRepository) AddBatch(urls []domain.URL, ctx context.Context) error {
-	for _, url := range urls {
-		if err := rmr.Add(&url, ctx); err != nil {
-			return err
+func (rmr *RAMRepository) Update(ctx context.Context, url *domain.URL) error {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
+
+	storedURL, exists := rmr.MapURL[url.ID]
+	if !exists || storedURL.UserID != url.UserID {
+		return errs.ErrURLNotFound
+	}
+
+	now := time.Now()
+	for _, existingURL := range rmr.MapURL {
+		if existingURL.ID != url.ID && blocksDedupe(existingURL.IsDeleted, existingURL.ExpiresAt, now) && isDuplicate(rmr.dedupeScope, existingURL.UserID, canonicalOrOriginal(existingURL.CanonicalURL, existingURL.OriginalURL),
+			url.UserID, canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)) {
+			return errs.NewOriginalURLAlreadyExists(&existingURL)
 		}
 	}
+
+	storedURL.OriginalURL = url.OriginalURL
+	storedURL.CanonicalURL = url.CanonicalURL
+	storedURL.ExpiresAt = url.ExpiresAt
+	storedURL.Tags = url.Tags
+	rmr.MapURL[url.ID] = storedURL
 	return nil
 }
 
+func (rmr *RAMRepository) AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error) {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
+
+	results := make([]BatchItemResult, len(urls))
+	for i, url := range urls {
+		result, err := newBatchItemResult(url.ID, rmr.add(&url))
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
 func (rmr *RAMRepository) Close() error {
 	return nil
 }
 
-func (rmr *RAMRepository) GetByUserID(ctx context.Context) (*[]domain.URL, error) {
-	var urls []domain.URL
-
-	// Получаем текущий UserID из контекста
-	userID := middleware.GetUserID(ctx)
+func (rmr *RAMRepository) GetURLsPage(ctx context.Context, query URLPageQuery) ([]domain.URL, error) {
+	rmr.mu.RLock()
+	defer rmr.mu.RUnlock()
 
-	// Проходим по всем URL в хранилище
+	var urls []domain.URL
 	for _, url := range rmr.MapURL {
-		// Сравниваем UserID
-		if url.UserID == userID {
+		if url.UserID == query.UserID {
 			urls = append(urls, url)
 		}
 	}
+	return pageURLs(urls, query), nil
+}
 
-	// Если не найдено ни одной записи
-	if len(urls) == 0 {
-		return nil, errors.New("no urls found for this user")
-	}
+func (rmr *RAMRepository) GetTags(ctx context.Context, userID string) ([]domain.TagCount, error) {
+	rmr.mu.RLock()
+	defer rmr.mu.RUnlock()
 
-	// Возвращаем список URL
-	return &urls, nil
+	counter := tagCounter{}
+	for _, url := range rmr.MapURL {
+		if url.UserID == userID {
+			counter.add(&url)
+		}
+	}
+	return counter.result(), nil
 }
 
-func (rmr *RAMRepository) GetFlagByShortURL(ctx context.Context, shortenedURL string) (bool, error) {
-	urlData, exists := rmr.MapURL[shortenedURL]
-	if !exists {
-		return false, errs.ErrURLNotFound
-	}
+func (rmr *RAMRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) error {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
 
-	// Возвращаем флаг is_deleted
-	return urlData.IsDeleted, nil
+	found := false
+	sourceSet := tagSet(sources)
+	for id, url := range rmr.MapURL {
+		if url.UserID != userID {
+			continue
+		}
+		if tags, changed := mergeTagList(url.Tags, sourceSet, target); changed {
+			url.Tags = tags
+			rmr.MapURL[id] = url
+			found = true
+		}
+	}
+	if !found {
+		return errs.ErrTagNotFound
+	}
+	return nil
 }
 
-func (rmr *RAMRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) error {
+func (rmr *RAMRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error) {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
+
+	var deleted []string
 	for _, url := range urls {
 		urlData, exists := rmr.MapURL[url.ShortURL]
 		if !exists {
@@ -93,8 +175,82 @@ func (rmr *RAMRepository) DeleteURLBatch(ctx context.Context, urls []UserShortUR
 		if urlData.UserID == url.UserID {
 			urlData.IsDeleted = true
 			rmr.MapURL[url.ShortURL] = urlData
+			deleted = append(deleted, url.ShortURL)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (rmr *RAMRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	rmr.mu.Lock()
+	defer rmr.mu.Unlock()
+
+	var count int64
+	for shortURL, urlData := range rmr.MapURL {
+		if urlData.IsDeleted || !urlData.IsExpired(now) {
+			continue
 		}
+		urlData.IsDeleted = true
+		rmr.MapURL[shortURL] = urlData
+		count++
 	}
+	return count, nil
+}
+
+func (rmr *RAMRepository) AddClicks(ctx context.Context, clicks []domain.Click) error {
+	rmr.clicksMu.Lock()
+	defer rmr.clicksMu.Unlock()
+
+	for _, click := range clicks {
+		rmr.clicks[click.ShortURL] = append(rmr.clicks[click.ShortURL], click)
+	}
+	return nil
+}
+
+func (rmr *RAMRepository) GetClickStats(ctx context.Context, shortURL string) (*domain.ClickStats, error) {
+	rmr.clicksMu.Lock()
+	defer rmr.clicksMu.Unlock()
+
+	return aggregateClicks(shortURL, rmr.clicks[shortURL]), nil
+}
 
+func (rmr *RAMRepository) AddDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	rmr.deleteJobs.put(job)
 	return nil
 }
+
+func (rmr *RAMRepository) ClaimDeleteJob(ctx context.Context, now time.Time, lease time.Duration) (*domain.DeleteJob, error) {
+	return rmr.deleteJobs.claim(now, lease), nil
+}
+
+func (rmr *RAMRepository) SaveDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	rmr.deleteJobs.put(job)
+	return nil
+}
+
+func (rmr *RAMRepository) CountActiveDeleteJobs(ctx context.Context) (int64, error) {
+	return rmr.deleteJobs.countActive(), nil
+}
+
+func (rmr *RAMRepository) GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error) {
+	return rmr.deleteJobs.get(id)
+}
+
+func (rmr *RAMRepository) AddAPIKey(ctx context.Context, key *domain.APIKey) error {
+	rmr.apiKeys.put(*key)
+	return nil
+}
+
+func (rmr *RAMRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	return rmr.apiKeys.getByHash(keyHash)
+}
+
+func (rmr *RAMRepository) GetAPIKeysByUser(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	return rmr.apiKeys.getByUser(userID), nil
+}
+
+func (rmr *RAMRepository) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	_, err := rmr.apiKeys.revoke(userID, id, revokedAt)
+	return err
+}
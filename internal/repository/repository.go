@@ -3,14 +3,35 @@ package repository
 import (
 	"context"
 	"github.com/pervukhinpm/link-shortener.git/domain"
+	"time"
 )
 
 type Repository interface {
 	Add(url *domain.URL, ctx context.Context) error
-	AddBatch(urls []domain.URL, ctx context.Context) error
+	// AddBatch возвращает исход каждого элемента в порядке urls; конфликты не прерывают пакет.
+	AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error)
 	Get(id string, ctx context.Context) (*domain.URL, error)
-	GetByUserID(ctx context.Context) (*[]domain.URL, error)
-	GetFlagByShortURL(ctx context.Context, shortenedURL string) (bool, error)
-	DeleteURLBatch(ctx context.Context, urls []UserShortURL) error
+	Update(ctx context.Context, url *domain.URL) error
+	// GetURLsPage возвращает страницу ссылок пользователя, упорядоченную по (created_at, short_url).
+	GetURLsPage(ctx context.Context, query URLPageQuery) ([]domain.URL, error)
+	// GetTags возвращает используемые теги пользователя с числом неудалённых ссылок.
+	GetTags(ctx context.Context, userID string) ([]domain.TagCount, error)
+	// MergeTags переносит ссылки с тегов sources на target и удаляет sources; переименование —
+	// слияние одного тега. Если ни одного из sources нет, возвращает errs.ErrTagNotFound.
+	MergeTags(ctx context.Context, userID string, sources []string, target string) error
+	DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+	AddClicks(ctx context.Context, clicks []domain.Click) error
+	GetClickStats(ctx context.Context, shortURL string) (*domain.ClickStats, error)
+	AddDeleteJob(ctx context.Context, job *domain.DeleteJob) error
+	ClaimDeleteJob(ctx context.Context, now time.Time, lease time.Duration) (*domain.DeleteJob, error)
+	SaveDeleteJob(ctx context.Context, job *domain.DeleteJob) error
+	GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error)
+	// CountActiveDeleteJobs возвращает число ожидающих и выполняющихся задач удаления.
+	CountActiveDeleteJobs(ctx context.Context) (int64, error)
+	AddAPIKey(ctx context.Context, key *domain.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	GetAPIKeysByUser(ctx context.Context, userID string) ([]domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) error
 	Close() error
 }
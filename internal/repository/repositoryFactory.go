@@ -6,18 +6,26 @@ import (
 
 func NewRepository(
 	dsn string,
+	sqlitePath string,
 	fileStoragePath string,
+	fileOptions FileRepositoryOptions,
+	dedupeScope string,
 	db *pgxpool.Pool,
 ) (Repository, error) {
 	// Если есть DSN и подключение к БД, создаем DatabaseRepository
 	if dsn != "" && db != nil {
-		return NewDatabaseRepository(db)
+		return NewDatabaseRepository(db, dedupeScope)
+	}
+
+	// Если задан путь к базе SQLite, создаем SQLiteRepository
+	if sqlitePath != "" {
+		return NewSQLiteRepository(sqlitePath, dedupeScope)
 	}
 
 	// Если есть путь к файловому хранилищу, создаем FileRepository
 	if fileStoragePath != "" {
-		return NewFileRepository(fileStoragePath)
+		return NewFileRepository(fileStoragePath, dedupeScope, fileOptions)
 	}
 
-	return NewRAMRepository()
+	return NewRAMRepository(dedupeScope)
 }
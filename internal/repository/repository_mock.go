@@ -29,10 +29,6 @@ func (m *MockRepository) Get(id string) (*domain.URL, error) {
 	return url, nil
 }
 
-func (m *MockRepository) GetFlagByShortURL(ctx context.Context, shortenedURL string) (bool, error) {
-	return false, nil
-}
-
 func (m *MockRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) error {
 	return nil
 }
@@ -0,0 +1,1033 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/utils"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Время хранится как unix-наносекунды в UTC: так сравнения и сортировка в SQL
+// не зависят от текстового формата дат.
+const nanosPerDay = int64(24 * time.Hour)
+
+type SQLiteRepository struct {
+	db          *sql.DB
+	dedupeScope string
+}
+
+func NewSQLiteRepository(path string, dedupeScope string) (*SQLiteRepository, error) {
+	if err := validateDedupeScope(dedupeScope); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	repository := SQLiteRepository{
+		db:          db,
+		dedupeScope: dedupeScope,
+	}
+	err = repository.createDB()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &repository, nil
+}
+
+// sqliteDSN включает WAL, чтобы чтения не блокировались записью, и busy_timeout,
+// чтобы конкурирующие писатели ждали блокировку вместо SQLITE_BUSY.
+// Транзакции сразу берут блокировку на запись (_txlock=immediate), иначе
+// две транзакции, начавшие с чтения, не смогут повысить блокировку.
+func sqliteDSN(path string) string {
+	query := url.Values{}
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	query.Set("_txlock", "immediate")
+	return "file:" + path + "?" + query.Encode()
+}
+
+func (sr *SQLiteRepository) Close() error {
+	return sr.db.Close()
+}
+
+// sqliteURLsTable — схема urls; имя таблицы подставляется, чтобы ею же пересоздавать таблицу.
+const sqliteURLsTable = `
+	CREATE TABLE IF NOT EXISTS %s (
+		uuid TEXT NOT NULL PRIMARY KEY,
+		short_url TEXT NOT NULL UNIQUE,
+		original_url TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		is_deleted INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER,
+		created_at INTEGER NOT NULL DEFAULT 0,
+		dedupe_key TEXT,
+		canonical_url TEXT NOT NULL DEFAULT ''
+	);`
+
+func (sr *SQLiteRepository) createDB() error {
+	query := fmt.Sprintf(sqliteURLsTable, "urls") + `
+	CREATE TABLE IF NOT EXISTS clicks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		short_url TEXT NOT NULL,
+		clicked_at INTEGER NOT NULL,
+		referrer TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip_hash TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS clicks_short_url_clicked_at_idx ON clicks (short_url, clicked_at);
+	CREATE TABLE IF NOT EXISTS delete_jobs (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		run_after INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS delete_jobs_active_idx ON delete_jobs (run_after) WHERE status IN ('pending', 'running');
+	CREATE TABLE IF NOT EXISTS delete_job_items (
+		job_id TEXT NOT NULL REFERENCES delete_jobs (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		short_url TEXT NOT NULL,
+		status TEXT NOT NULL,
+		PRIMARY KEY (job_id, position)
+	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		revoked_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		UNIQUE (user_id, name)
+	);
+	CREATE TABLE IF NOT EXISTS url_tags (
+		short_url TEXT NOT NULL REFERENCES urls (short_url) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (short_url, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS url_tags_tag_id_idx ON url_tags (tag_id);
+	CREATE TABLE IF NOT EXISTS settings (
+		name TEXT NOT NULL PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+	if _, err := sr.db.Exec(query); err != nil {
+		return err
+	}
+
+	// Базы, созданные до появления created_at, дополняются колонкой; старые ссылки получают 0
+	if err := sr.addColumnIfMissing("urls", "created_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// Канонический вид старых ссылок неизвестен — для них дедупликация идёт по исходному URL
+	if err := sr.addColumnIfMissing("urls", "canonical_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := sr.db.Exec(`UPDATE urls SET canonical_url = original_url WHERE canonical_url = '';`); err != nil {
+		return err
+	}
+	if err := sr.migrateDedupeKey(); err != nil {
+		return err
+	}
+
+	query = `
+	CREATE INDEX IF NOT EXISTS urls_user_id_idx ON urls (user_id);
+	CREATE INDEX IF NOT EXISTS urls_expires_at_idx ON urls (expires_at) WHERE expires_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx ON urls (user_id, created_at, short_url);`
+	if _, err := sr.db.Exec(query); err != nil {
+		return err
+	}
+	if err := sr.createDedupeKeyIndex(); err != nil {
+		return err
+	}
+	if err := sr.applyDedupeScope(); err != nil {
+		return fmt.Errorf("apply dedupe scope %q: %w", sr.dedupeScope, err)
+	}
+	return nil
+}
+
+// applyDedupeScope пересчитывает ключи существующих ссылок, только если область
+// дедупликации отличается от записанной в settings; транзакция сразу берёт блокировку
+// на запись, так что процессы на одной базе делают это по очереди. При ужесточении
+// области уже существующие дубли не дадут запуститься.
+func (sr *SQLiteRepository) applyDedupeScope() error {
+	tx, err := sr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied string
+	err = tx.QueryRow(`SELECT value FROM settings WHERE name = 'dedupe_scope';`).Scan(&applied)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if applied == sr.dedupeScope {
+		return nil
+	}
+
+	middleware.Log.Infow("Recomputing dedupe keys", "from", applied, "to", sr.dedupeScope)
+	expr := dedupeKeySQL(sr.dedupeScope)
+	if _, err := tx.Exec("UPDATE urls SET dedupe_key = " + expr + " WHERE dedupe_key IS NOT " + expr); err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO settings (name, value) VALUES ('dedupe_scope', ?)
+	ON CONFLICT (name) DO UPDATE SET value = excluded.value;
+	`
+	if _, err := tx.Exec(query, sr.dedupeScope); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createDedupeKeyIndex создаёт частичный уникальный индекс по dedupe_key, заменяя
+// полный индекс старых баз: удалённые ссылки не мешают сократить URL заново.
+func (sr *SQLiteRepository) createDedupeKeyIndex() error {
+	var definition string
+	err := sr.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'index' AND name = 'urls_dedupe_key_key';`).Scan(&definition)
+	if err == nil && strings.Contains(definition, "WHERE") {
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	query := `
+	DROP INDEX IF EXISTS urls_dedupe_key_key;
+	CREATE UNIQUE INDEX urls_dedupe_key_key ON urls (dedupe_key) WHERE NOT is_deleted;`
+	_, err = sr.db.Exec(query)
+	return err
+}
+
+// migrateDedupeKey пересоздаёт urls из баз, где original_url был UNIQUE: снять
+// ограничение через ALTER TABLE в SQLite нельзя.
+func (sr *SQLiteRepository) migrateDedupeKey() error {
+	var count int
+	err := sr.db.QueryRow(`SELECT count(*) FROM pragma_table_info('urls') WHERE name = 'dedupe_key';`).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := sr.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Иначе DROP TABLE каскадно удалит теги ссылок
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF;`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON;`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(sqliteURLsTable, "urls_new") + `
+	INSERT INTO urls_new (uuid, short_url, original_url, user_id, is_deleted, expires_at, created_at, dedupe_key, canonical_url)
+	SELECT uuid, short_url, original_url, user_id, is_deleted, expires_at, created_at, canonical_url, canonical_url FROM urls;
+	DROP TABLE urls;
+	ALTER TABLE urls_new RENAME TO urls;`
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sr *SQLiteRepository) addColumnIfMissing(table, column, definition string) error {
+	var count int
+	err := sr.db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name = ?;`, table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = sr.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// sqliteURLTagsColumn собирает отсортированные теги ссылки через запятую; запятая
+// в тегах не допускается.
+const sqliteURLTagsColumn = `(SELECT group_concat(name, ',') FROM (SELECT t.name FROM url_tags ut
+	JOIN tags t ON t.id = ut.tag_id WHERE ut.short_url = urls.short_url ORDER BY t.name))`
+
+// sqlExecer позволяет выполнять одни и те же запросы как в транзакции, так и без неё.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (sr *SQLiteRepository) Add(url *domain.URL, ctx context.Context) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID := middleware.GetUserID(ctx)
+	if err := sr.insertURL(ctx, tx, url, userID); err != nil {
+		return err
+	}
+	if err := sr.setURLTags(ctx, tx, userID, url.ID, url.Tags); err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// setURLTags заменяет теги ссылки, заводя недостающие теги пользователя.
+func (sr *SQLiteRepository) setURLTags(ctx context.Context, db sqlExecer, userID, shortURL string, tags []string) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM url_tags WHERE short_url = ?;`, shortURL); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		query := `
+		INSERT INTO tags (user_id, name) VALUES (?, ?) ON CONFLICT (user_id, name) DO NOTHING;
+		`
+		if _, err := db.ExecContext(ctx, query, userID, tag); err != nil {
+			return err
+		}
+		query = `
+		INSERT INTO url_tags (short_url, tag_id) SELECT ?, id FROM tags WHERE user_id = ? AND name = ?;
+		`
+		if _, err := db.ExecContext(ctx, query, shortURL, userID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sr *SQLiteRepository) insertURL(ctx context.Context, db sqlExecer, url *domain.URL, userID string) error {
+	uuid, err := utils.GenerateUUID()
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error generating uuid", "error", err)
+		return err
+	}
+
+	query := `
+	INSERT INTO urls (uuid, short_url, original_url, user_id, is_deleted, expires_at, created_at, dedupe_key, canonical_url)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (dedupe_key) WHERE NOT is_deleted DO NOTHING;
+	`
+	createdAt := ensureCreatedAt(url)
+	canonicalURL := canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)
+	key := dedupeKey(sr.dedupeScope, userID, canonicalURL)
+	if err := sr.deleteExpiredDuplicate(ctx, db, key, url.ID); err != nil {
+		return err
+	}
+	result, err := db.ExecContext(ctx, query, uuid, url.ID, url.OriginalURL, userID, url.IsDeleted, toUnixNano(url.ExpiresAt), toUnixNano(&createdAt), key, canonicalURL)
+	if err != nil {
+		if isSQLiteUniqueViolation(err, "urls.short_url") {
+			return errs.NewShortURLAlreadyExists(url.ID)
+		}
+		middleware.LogFromContext(ctx).Errorw("Error inserting url", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		middleware.LogFromContext(ctx).Infow("URL already exists, fetching existing short URL", "original_url", url.OriginalURL)
+
+		existingShortURL, err := sr.getShortURLByDedupeKey(ctx, db, *key)
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error getting existing short URL", "error", err)
+			return err
+		}
+
+		return errs.NewOriginalURLAlreadyExists(domain.NewURL(existingShortURL, url.OriginalURL, userID, false))
+	}
+
+	return nil
+}
+
+func (sr *SQLiteRepository) getShortURLByDedupeKey(ctx context.Context, db sqlExecer, key string) (string, error) {
+	query := `
+	SELECT short_url FROM urls WHERE dedupe_key = ? AND NOT is_deleted;
+	`
+	var shortURL string
+	err := db.QueryRowContext(ctx, query, key).Scan(&shortURL)
+	if err != nil {
+		return "", err
+	}
+	return shortURL, nil
+}
+
+// deleteExpiredDuplicate помечает удалённой истёкшую, но ещё не убранную фоновой
+// очисткой ссылку с тем же ключом, кроме самой shortURL, чтобы она не заняла уникальный индекс.
+func (sr *SQLiteRepository) deleteExpiredDuplicate(ctx context.Context, db sqlExecer, key *string, shortURL string) error {
+	if key == nil {
+		return nil
+	}
+	query := `
+	UPDATE urls SET is_deleted = 1
+	WHERE dedupe_key = ? AND short_url <> ? AND NOT is_deleted AND expires_at IS NOT NULL AND expires_at <= ?;
+	`
+	_, err := db.ExecContext(ctx, query, *key, shortURL, time.Now().UnixNano())
+	return err
+}
+
+func (sr *SQLiteRepository) AddBatch(urls []domain.URL, ctx context.Context) ([]BatchItemResult, error) {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID := middleware.GetUserID(ctx)
+
+	results := make([]BatchItemResult, len(urls))
+	for i := range urls {
+		result, err := newBatchItemResult(urls[i].ID, sr.insertURL(ctx, tx, &urls[i], userID))
+		if err != nil {
+			return nil, err
+		}
+		if result.Status == BatchItemCreated {
+			if err := sr.setURLTags(ctx, tx, userID, urls[i].ID, urls[i].Tags); err != nil {
+				middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+				return nil, err
+			}
+		}
+		results[i] = result
+	}
+
+	return results, tx.Commit()
+}
+
+func (sr *SQLiteRepository) Get(id string, ctx context.Context) (*domain.URL, error) {
+	query := `
+	SELECT original_url, canonical_url, user_id, is_deleted, expires_at, created_at, ` + sqliteURLTagsColumn + ` FROM urls WHERE short_url = ?;
+	`
+	var originalURL, canonicalURL, userID string
+	var isDeleted bool
+	var expiresAt sql.NullInt64
+	var createdAt int64
+	var tags sql.NullString
+	err := sr.db.QueryRowContext(ctx, query, id).Scan(&originalURL, &canonicalURL, &userID, &isDeleted, &expiresAt, &createdAt, &tags)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrURLNotFound
+		}
+		return nil, err
+	}
+
+	url := domain.NewURL(id, originalURL, userID, isDeleted)
+	url.ExpiresAt = fromUnixNano(expiresAt)
+	url.CreatedAt = time.Unix(0, createdAt).UTC()
+	url.Tags = splitSQLiteTags(tags)
+	url.CanonicalURL = canonicalURL
+	return url, nil
+}
+
+func (sr *SQLiteRepository) Update(ctx context.Context, url *domain.URL) error {
+	query := `
+	UPDATE urls SET original_url = ?, expires_at = ?, dedupe_key = ?, canonical_url = ?
+	WHERE short_url = ? AND user_id = ? AND NOT is_deleted;
+	`
+	canonicalURL := canonicalOrOriginal(url.CanonicalURL, url.OriginalURL)
+	key := dedupeKey(sr.dedupeScope, url.UserID, canonicalURL)
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sr.deleteExpiredDuplicate(ctx, tx, key, url.ID); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, url.OriginalURL, toUnixNano(url.ExpiresAt), key, canonicalURL, url.ID, url.UserID)
+	if err != nil {
+		if isSQLiteUniqueViolation(err, "urls.dedupe_key") {
+			existingShortURL, err := sr.getShortURLByDedupeKey(ctx, tx, *key)
+			if err != nil {
+				return err
+			}
+			return errs.NewOriginalURLAlreadyExists(domain.NewURL(existingShortURL, url.OriginalURL, "", false))
+		}
+		middleware.LogFromContext(ctx).Errorw("Error updating url", "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errs.ErrURLNotFound
+	}
+	if err := sr.setURLTags(ctx, tx, url.UserID, url.ID, url.Tags); err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error saving url tags", "error", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sr *SQLiteRepository) GetURLsPage(ctx context.Context, query URLPageQuery) ([]domain.URL, error) {
+	conditions := []string{"user_id = ?"}
+	args := []any{query.UserID}
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "NOT is_deleted", "(expires_at IS NULL OR expires_at > ?)")
+		args = append(args, query.Now.UnixNano())
+	}
+	if query.Search != "" {
+		conditions = append(conditions, "instr(original_url, ?) > 0")
+		args = append(args, query.Search)
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM url_tags ut JOIN tags t ON t.id = ut.tag_id "+
+			"WHERE ut.short_url = urls.short_url AND t.name = ?)")
+		args = append(args, query.Tag)
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, query.CreatedAfter.UnixNano())
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.CreatedBefore.UnixNano())
+	}
+	order := "ASC"
+	if query.Descending {
+		order = "DESC"
+	}
+	if query.After != nil {
+		comparison := ">"
+		if query.Descending {
+			comparison = "<"
+		}
+		conditions = append(conditions, "(created_at, short_url) "+comparison+" (?, ?)")
+		args = append(args, query.After.CreatedAt.UnixNano(), query.After.ShortURL)
+	}
+
+	sqlQuery := "SELECT short_url, original_url, canonical_url, is_deleted, expires_at, created_at, " + sqliteURLTagsColumn + " FROM urls WHERE " +
+		strings.Join(conditions, " AND ") +
+		" ORDER BY created_at " + order + ", short_url " + order
+	if query.Limit > 0 {
+		sqlQuery += " LIMIT ?"
+		args = append(args, query.Limit)
+	}
+
+	rows, err := sr.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying URLs page", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []domain.URL
+	for rows.Next() {
+		var shortURL, originalURL, canonicalURL string
+		var isDeleted bool
+		var expiresAt sql.NullInt64
+		var createdAt int64
+		var tags sql.NullString
+		if err := rows.Scan(&shortURL, &originalURL, &canonicalURL, &isDeleted, &expiresAt, &createdAt, &tags); err != nil {
+			return nil, err
+		}
+		url := domain.NewURL(shortURL, originalURL, query.UserID, isDeleted)
+		url.ExpiresAt = fromUnixNano(expiresAt)
+		url.CreatedAt = time.Unix(0, createdAt).UTC()
+		url.Tags = splitSQLiteTags(tags)
+		url.CanonicalURL = canonicalURL
+		urls = append(urls, *url)
+	}
+	return urls, rows.Err()
+}
+
+func (sr *SQLiteRepository) GetTags(ctx context.Context, userID string) ([]domain.TagCount, error) {
+	query := `
+	SELECT t.name, count(*) FROM tags t
+	JOIN url_tags ut ON ut.tag_id = t.id
+	JOIN urls u ON u.short_url = ut.short_url
+	WHERE t.user_id = ? AND NOT u.is_deleted
+	GROUP BY t.name ORDER BY t.name;
+	`
+	rows, err := sr.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying tags", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []domain.TagCount{}
+	for rows.Next() {
+		var tag domain.TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, tag)
+	}
+	return result, rows.Err()
+}
+
+func (sr *SQLiteRepository) MergeTags(ctx context.Context, userID string, sources []string, target string) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO tags (user_id, name) VALUES (?, ?) ON CONFLICT (user_id, name) DO NOTHING;
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, target); err != nil {
+		return err
+	}
+
+	found := false
+	for _, source := range sources {
+		query := `
+		INSERT INTO url_tags (short_url, tag_id)
+		SELECT ut.short_url, (SELECT id FROM tags WHERE user_id = ? AND name = ?)
+		FROM url_tags ut JOIN tags t ON t.id = ut.tag_id
+		WHERE t.user_id = ? AND t.name = ?
+		ON CONFLICT DO NOTHING;
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, target, userID, source); err != nil {
+			return err
+		}
+		query = `
+		DELETE FROM url_tags WHERE tag_id = (SELECT id FROM tags WHERE user_id = ? AND name = ?);
+		`
+		result, err := tx.ExecContext(ctx, query, userID, source)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected > 0 {
+			found = true
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE user_id = ? AND name = ?;`, userID, source); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errs.ErrTagNotFound
+	}
+	return tx.Commit()
+}
+
+func splitSQLiteTags(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return nil
+	}
+	return strings.Split(tags.String, ",")
+}
+
+func (sr *SQLiteRepository) DeleteURLBatch(ctx context.Context, urls []UserShortURL) ([]string, error) {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE urls SET is_deleted = 1 WHERE user_id = ? AND short_url = ?;
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var deleted []string
+	for _, v := range urls {
+		result, err := stmt.ExecContext(ctx, v.UserID, v.ShortURL)
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error deleting short URLs", "error", err)
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected > 0 {
+			deleted = append(deleted, v.ShortURL)
+		}
+	}
+
+	return deleted, tx.Commit()
+}
+
+func (sr *SQLiteRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+	UPDATE urls SET is_deleted = 1
+	WHERE expires_at IS NOT NULL AND expires_at <= ? AND NOT is_deleted;
+	`
+	result, err := sr.db.ExecContext(ctx, query, now.UnixNano())
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error deleting expired urls", "error", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (sr *SQLiteRepository) AddClicks(ctx context.Context, clicks []domain.Click) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, ip_hash) VALUES (?, ?, ?, ?, ?);
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range clicks {
+		_, err := stmt.ExecContext(ctx, c.ShortURL, c.ClickedAt.UnixNano(), c.Referrer, c.UserAgent, c.IPHash)
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error inserting clicks", "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sr *SQLiteRepository) GetClickStats(ctx context.Context, shortURL string) (*domain.ClickStats, error) {
+	stats := &domain.ClickStats{ShortURL: shortURL}
+
+	totalsQuery := `
+	SELECT count(*), count(DISTINCT ip_hash) FROM clicks WHERE short_url = ?;
+	`
+	err := sr.db.QueryRowContext(ctx, totalsQuery, shortURL).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying click totals", "error", err)
+		return nil, err
+	}
+
+	dailyQuery := `
+	SELECT clicked_at / ? AS day, count(*)
+	FROM clicks WHERE short_url = ?
+	GROUP BY day ORDER BY day;
+	`
+	rows, err := sr.db.QueryContext(ctx, dailyQuery, nanosPerDay, shortURL)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying daily clicks", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day int64
+		var daily domain.DailyClicks
+		if err := rows.Scan(&day, &daily.Clicks); err != nil {
+			return nil, err
+		}
+		daily.Day = time.Unix(0, day*nanosPerDay).UTC()
+		stats.Daily = append(stats.Daily, daily)
+	}
+
+	return stats, rows.Err()
+}
+
+func (sr *SQLiteRepository) AddDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO delete_jobs (id, user_id, status, attempts, last_error, run_after, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err = tx.ExecContext(ctx, query, job.ID, job.UserID, job.Status, job.Attempts, job.LastError,
+		job.RunAfter.UnixNano(), job.CreatedAt.UnixNano(), job.UpdatedAt.UnixNano())
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting delete job", "error", err)
+		return err
+	}
+
+	itemsQuery := `
+	INSERT INTO delete_job_items (job_id, position, short_url, status) VALUES (?, ?, ?, ?);
+	`
+	for i, item := range job.Items {
+		_, err = tx.ExecContext(ctx, itemsQuery, job.ID, i, item.ShortURL, item.Status)
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error inserting delete job items", "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sr *SQLiteRepository) ClaimDeleteJob(ctx context.Context, now time.Time, lease time.Duration) (*domain.DeleteJob, error) {
+	// SQLite сериализует запись, поэтому одного UPDATE ... RETURNING достаточно для захвата задачи
+	query := `
+	UPDATE delete_jobs SET status = ?, attempts = attempts + 1, run_after = ?, updated_at = ?
+	WHERE id = (
+		SELECT id FROM delete_jobs
+		WHERE status IN ('pending', 'running') AND run_after <= ?
+		ORDER BY created_at
+		LIMIT 1
+	)
+	RETURNING id, user_id, status, attempts, last_error, run_after, created_at, updated_at;
+	`
+	job, err := scanDeleteJob(sr.db.QueryRowContext(ctx, query,
+		domain.DeleteJobRunning, now.Add(lease).UnixNano(), now.UnixNano(), now.UnixNano()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		middleware.LogFromContext(ctx).Errorw("Error claiming delete job", "error", err)
+		return nil, err
+	}
+
+	job.Items, err = sr.getDeleteJobItems(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (sr *SQLiteRepository) SaveDeleteJob(ctx context.Context, job *domain.DeleteJob) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	jobQuery := `
+	UPDATE delete_jobs SET status = ?, attempts = ?, last_error = ?, run_after = ?, updated_at = ?
+	WHERE id = ?;
+	`
+	_, err = tx.ExecContext(ctx, jobQuery, job.Status, job.Attempts, job.LastError,
+		job.RunAfter.UnixNano(), job.UpdatedAt.UnixNano(), job.ID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error updating delete job", "error", err)
+		return err
+	}
+
+	itemsQuery := `
+	UPDATE delete_job_items SET status = ? WHERE job_id = ? AND position = ?;
+	`
+	for i, item := range job.Items {
+		_, err = tx.ExecContext(ctx, itemsQuery, item.Status, job.ID, i)
+		if err != nil {
+			middleware.LogFromContext(ctx).Errorw("Error updating delete job items", "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sr *SQLiteRepository) CountActiveDeleteJobs(ctx context.Context) (int64, error) {
+	query := `
+	SELECT count(*) FROM delete_jobs WHERE status IN ('pending', 'running');
+	`
+	var count int64
+	err := sr.db.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
+
+func (sr *SQLiteRepository) GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error) {
+	query := `
+	SELECT id, user_id, status, attempts, last_error, run_after, created_at, updated_at
+	FROM delete_jobs WHERE id = ?;
+	`
+	job, err := scanDeleteJob(sr.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	job.Items, err = sr.getDeleteJobItems(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func scanDeleteJob(row *sql.Row) (*domain.DeleteJob, error) {
+	var job domain.DeleteJob
+	var runAfter, createdAt, updatedAt int64
+	err := row.Scan(&job.ID, &job.UserID, &job.Status, &job.Attempts, &job.LastError, &runAfter, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.RunAfter = time.Unix(0, runAfter).UTC()
+	job.CreatedAt = time.Unix(0, createdAt).UTC()
+	job.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return &job, nil
+}
+
+func (sr *SQLiteRepository) getDeleteJobItems(ctx context.Context, jobID string) ([]domain.DeleteJobItem, error) {
+	query := `
+	SELECT short_url, status FROM delete_job_items WHERE job_id = ? ORDER BY position;
+	`
+	rows, err := sr.db.QueryContext(ctx, query, jobID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying delete job items", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.DeleteJobItem
+	for rows.Next() {
+		var item domain.DeleteJobItem
+		if err := rows.Scan(&item.ShortURL, &item.Status); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (sr *SQLiteRepository) AddAPIKey(ctx context.Context, key *domain.APIKey) error {
+	query := `
+	INSERT INTO api_keys (id, user_id, name, key_hash, prefix, scopes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+	_, err := sr.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.KeyHash, key.Prefix,
+		strings.Join(key.Scopes, ","), key.CreatedAt.UnixNano())
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error inserting api key", "error", err)
+	}
+	return err
+}
+
+func (sr *SQLiteRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	query := `
+	SELECT id, user_id, name, key_hash, prefix, scopes, created_at, revoked_at
+	FROM api_keys WHERE key_hash = ?;
+	`
+	rows, err := sr.db.QueryContext(ctx, query, keyHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrAPIKeyNotFound
+	}
+	return scanAPIKey(rows)
+}
+
+func (sr *SQLiteRepository) GetAPIKeysByUser(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	query := `
+	SELECT id, user_id, name, key_hash, prefix, scopes, created_at, revoked_at
+	FROM api_keys WHERE user_id = ? ORDER BY created_at;
+	`
+	rows, err := sr.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error querying api keys", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []domain.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func scanAPIKey(rows *sql.Rows) (*domain.APIKey, error) {
+	var key domain.APIKey
+	var scopes string
+	var createdAt int64
+	var revokedAt sql.NullInt64
+	err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.KeyHash, &key.Prefix, &scopes, &createdAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.CreatedAt = time.Unix(0, createdAt).UTC()
+	key.RevokedAt = fromUnixNano(revokedAt)
+	return &key, nil
+}
+
+func (sr *SQLiteRepository) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	query := `
+	UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND user_id = ?;
+	`
+	result, err := sr.db.ExecContext(ctx, query, revokedAt.UnixNano(), id, userID)
+	if err != nil {
+		middleware.LogFromContext(ctx).Errorw("Error revoking api key", "error", err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errs.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// isSQLiteUniqueViolation проверяет нарушение уникальности по колонке вида "table.column":
+// в отличие от Postgres, SQLite не сообщает имя ограничения отдельным полем.
+func isSQLiteUniqueViolation(err error, column string) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return false
+	}
+	return strings.Contains(sqliteErr.Error(), column)
+}
+
+func toUnixNano(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := time.Unix(0, value.Int64).UTC()
+	return &t
+}
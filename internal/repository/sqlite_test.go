@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteRepository(t *testing.T) *SQLiteRepository {
+	t.Helper()
+	middleware.Initialize()
+
+	repo, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "shortener.db"), DedupeGlobal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestSQLiteRepositoryDuplicates(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+	if err := repo.Add(domain.NewURL("abc", "https://practicum.yandex.ru/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var originalURLAlreadyExists *errs.OriginalURLAlreadyExists
+	err := repo.Add(domain.NewURL("xyz", "https://practicum.yandex.ru/", "user", false), ctx)
+	if !errors.As(err, &originalURLAlreadyExists) || originalURLAlreadyExists.URL.ID != "abc" {
+		t.Fatalf("Add() with duplicate original URL error = %v", err)
+	}
+
+	var shortURLAlreadyExists *errs.ShortURLAlreadyExists
+	err = repo.Add(domain.NewURL("abc", "https://yandex.ru/", "user", false), ctx)
+	if !errors.As(err, &shortURLAlreadyExists) {
+		t.Fatalf("Add() with duplicate short URL error = %v", err)
+	}
+
+	err = repo.Update(ctx, domain.NewURL("abc", "https://practicum.yandex.ru/", "user", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(domain.NewURL("def", "https://yandex.ru/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Update(ctx, domain.NewURL("def", "https://practicum.yandex.ru/", "user", false))
+	if !errors.As(err, &originalURLAlreadyExists) || originalURLAlreadyExists.URL.ID != "abc" {
+		t.Fatalf("Update() with duplicate original URL error = %v", err)
+	}
+}
+
+func TestSQLiteRepositoryBatchAndDelete(t *testing.T) {
+	repo := newTestSQLiteRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expiring := domain.NewURL("old", "https://old.example/", "user", false)
+	expiring.ExpiresAt = &expiresAt
+
+	_, err := repo.AddBatch([]domain.URL{
+		*domain.NewURL("one", "https://one.example/", "user", false),
+		*domain.NewURL("two", "https://two.example/", "user", false),
+		*expiring,
+	}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := repo.GetURLsPage(ctx, URLPageQuery{UserID: "user", IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 3 {
+		t.Fatalf("GetURLsPage() returned %d urls, want 3", len(urls))
+	}
+
+	deleted, err := repo.DeleteURLBatch(ctx, []UserShortURL{
+		{UserID: "user", ShortURL: "one"},
+		{UserID: "another", ShortURL: "two"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "one" {
+		t.Fatalf("DeleteURLBatch() = %v, want [one]", deleted)
+	}
+
+	expired, err := repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("DeleteExpired() = %d, want 1", expired)
+	}
+
+	for id, wantDeleted := range map[string]bool{"one": true, "two": false, "old": true} {
+		url, err := repo.Get(id, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url.IsDeleted != wantDeleted {
+			t.Errorf("Get(%s).IsDeleted = %v, want %v", id, url.IsDeleted, wantDeleted)
+		}
+	}
+
+	if _, err := repo.Get("missing", ctx); !errors.Is(err, errs.ErrURLNotFound) {
+		t.Fatalf("Get() error = %v, want %v", err, errs.ErrURLNotFound)
+	}
+}
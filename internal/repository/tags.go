@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"sort"
+)
+
+// mergeTagList заменяет в списке тегов любой из sources на target.
+// Второе значение сообщает, был ли список изменён.
+func mergeTagList(tags []string, sources map[string]bool, target string) ([]string, bool) {
+	result := make([]string, 0, len(tags)+1)
+	changed, hasTarget := false, false
+	for _, tag := range tags {
+		if sources[tag] {
+			changed = true
+			continue
+		}
+		if tag == target {
+			hasTarget = true
+		}
+		result = append(result, tag)
+	}
+	if !changed {
+		return tags, false
+	}
+	if !hasTarget {
+		result = append(result, target)
+		sort.Strings(result)
+	}
+	return result, true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagCounter считает теги неудалённых ссылок для хранилищ в памяти.
+type tagCounter map[string]int64
+
+func (c tagCounter) add(url *domain.URL) {
+	if url.IsDeleted {
+		return
+	}
+	for _, tag := range url.Tags {
+		c[tag]++
+	}
+}
+
+func (c tagCounter) result() []domain.TagCount {
+	result := make([]domain.TagCount, 0, len(c))
+	for name, count := range c {
+		result = append(result, domain.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func tagSet(tags []string) map[string]bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return set
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"reflect"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	middleware.Initialize()
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+			add := func(id string, tags ...string) {
+				url := domain.NewURL(id, "https://"+id+".example/", "user", false)
+				url.Tags = tags
+				if err := repo.Add(url, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			add("a", "go", "news")
+			add("b", "golang")
+			add("c", "go", "golang")
+			add("d")
+
+			other := context.WithValue(context.Background(), middleware.UserID{}, "other")
+			batch := []domain.URL{*domain.NewURL("e", "https://e.example/", "other", false)}
+			batch[0].Tags = []string{"batch"}
+			if _, err := repo.AddBatch(batch, other); err != nil {
+				t.Fatal(err)
+			}
+			if url, err := repo.Get("e", other); err != nil || !reflect.DeepEqual(url.Tags, []string{"batch"}) {
+				t.Errorf("Get().Tags after AddBatch = %v, %v, want [batch]", url, err)
+			}
+
+			url, err := repo.Get("a", ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(url.Tags, []string{"go", "news"}) {
+				t.Errorf("Get().Tags = %v", url.Tags)
+			}
+
+			url.Tags = []string{"news"}
+			if err := repo.Update(ctx, url); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.DeleteURLBatch(ctx, []UserShortURL{{UserID: "user", ShortURL: "b"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			tags, err := repo.GetTags(ctx, "user")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []domain.TagCount{{Name: "go", Count: 1}, {Name: "golang", Count: 1}, {Name: "news", Count: 1}}
+			if !reflect.DeepEqual(tags, want) {
+				t.Errorf("GetTags() = %v, want %v", tags, want)
+			}
+
+			if err := repo.MergeTags(ctx, "user", []string{"golang"}, "go"); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.MergeTags(ctx, "user", []string{"golang"}, "go"); !errors.Is(err, errs.ErrTagNotFound) {
+				t.Errorf("MergeTags() of a missing tag error = %v, want %v", err, errs.ErrTagNotFound)
+			}
+
+			page, err := repo.GetURLsPage(ctx, URLPageQuery{UserID: "user", Tag: "go", IncludeDeleted: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, url := range page {
+				ids = append(ids, url.ID)
+				if !reflect.DeepEqual(url.Tags, []string{"go"}) {
+					t.Errorf("%s tags after merge = %v, want [go]", url.ID, url.Tags)
+				}
+			}
+			if !reflect.DeepEqual(ids, []string{"b", "c"}) {
+				t.Errorf("GetURLsPage(tag=go) = %v, want [b c]", ids)
+			}
+		})
+	}
+}
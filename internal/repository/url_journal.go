@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Типы записей журнала. Строки без op остались от старого формата файла
+// и применяются как create: последняя запись с тем же short_url побеждает.
+const (
+	JournalOpCreate = "create"
+	JournalOpUpdate = "update"
+	JournalOpDelete = "delete"
+)
+
+// Политики сброса журнала на диск.
+const (
+	SyncAlways   = "always"
+	SyncInterval = "interval"
+	SyncNever    = "never"
+)
+
+type FileRepositoryOptions struct {
+	// SyncPolicy: always — fsync после каждой записи, interval — раз в SyncInterval,
+	// never — полагаться на ОС.
+	SyncPolicy   string
+	SyncInterval time.Duration
+	// CompactAfter — сколько устаревших записей допускается в журнале до компакции; 0 отключает её.
+	CompactAfter int
+}
+
+type URLJournalRecord struct {
+	Op string `json:"op,omitempty"`
+	URLFileModel
+}
+
+// URLJournal — журнал операций над ссылками поверх jsonLinesWriter.
+type URLJournal struct {
+	mu sync.Mutex
+	*jsonLinesWriter
+}
+
+func OpenURLJournal(path string, policy string) (*URLJournal, error) {
+	switch policy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown file sync policy %q", policy)
+	}
+
+	writer, err := openJSONLinesWriter(path, policy, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &URLJournal{jsonLinesWriter: writer}, nil
+}
+
+// Append дописывает записи одним сбросом буфера, поэтому пакет операций стоит один fsync.
+func (j *URLJournal) Append(records ...URLJournalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range records {
+		if err := j.write(&records[i]); err != nil {
+			return err
+		}
+	}
+	return j.flush()
+}
+
+func (j *URLJournal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.sync()
+}
+
+// Records возвращает число записей в журнале, включая устаревшие.
+func (j *URLJournal) Records() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.records
+}
+
+// Compact заменяет журнал снимком текущего состояния.
+func (j *URLJournal) Compact(snapshot []URLFileModel) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	records := make([]any, len(snapshot))
+	for i, model := range snapshot {
+		records[i] = &URLJournalRecord{Op: JournalOpCreate, URLFileModel: model}
+	}
+	return j.compact(records)
+}
+
+func (j *URLJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.close()
+}
+
+// ReplayURLJournal восстанавливает состояние ссылок из журнала и возвращает число прочитанных записей.
+// Недописанная последняя строка (сбой посреди записи) отрезается, повреждение в середине — ошибка.
+func ReplayURLJournal(path string) (map[string]URLFileModel, int, error) {
+	storage := make(map[string]URLFileModel)
+	records, err := replayJSONLines(path, func(record URLJournalRecord) {
+		applyJournalRecord(storage, record)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return storage, records, nil
+}
+
+func applyJournalRecord(storage map[string]URLFileModel, record URLJournalRecord) {
+	switch record.Op {
+	case JournalOpDelete:
+		if stored, ok := storage[record.ShortURL]; ok {
+			stored.IsDeleted = true
+			storage[record.ShortURL] = stored
+		}
+	default:
+		storage[record.ShortURL] = record.URLFileModel
+	}
+}
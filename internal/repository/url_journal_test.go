@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayURLJournal(t *testing.T) {
+	middleware.Initialize()
+
+	tests := []struct {
+		name        string
+		content     string
+		wantDeleted map[string]bool
+		wantErr     bool
+		wantContent string
+	}{
+		{
+			name: "legacy records without op",
+			content: `{"uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":false}
+{"uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":true}
+`,
+			wantDeleted: map[string]bool{"a": true},
+		},
+		{
+			name: "create update delete",
+			content: `{"op":"create","uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":false}
+{"op":"create","uuid":"2","user_uuid":"u","short_url":"b","original_url":"https://b.example/","is_deleted":false}
+{"op":"update","uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://c.example/","is_deleted":false}
+{"op":"delete","uuid":"2","user_uuid":"u","short_url":"b","original_url":"","is_deleted":false}
+`,
+			wantDeleted: map[string]bool{"a": false, "b": true},
+		},
+		{
+			name: "truncated last line",
+			content: `{"op":"create","uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":false}
+{"op":"delete","uuid":"1","user_uuid":"u","sho`,
+			wantDeleted: map[string]bool{"a": false},
+			wantContent: `{"op":"create","uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":false}
+`,
+		},
+		{
+			name: "corrupted record in the middle",
+			content: `{"op":"create","uuid":"1","user_uuid":"u","short_url":"a","original_url":"https://a.example/","is_deleted":false}
+{"op":
+{"op":"create","uuid":"2","user_uuid":"u","short_url":"b","original_url":"https://b.example/","is_deleted":false}
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			storage, _, err := ReplayURLJournal(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(storage) != len(tt.wantDeleted) {
+				t.Fatalf("replayed %d urls, want %d", len(storage), len(tt.wantDeleted))
+			}
+			for shortURL, wantDeleted := range tt.wantDeleted {
+				if storage[shortURL].IsDeleted != wantDeleted {
+					t.Errorf("%s.IsDeleted = %v, want %v", shortURL, storage[shortURL].IsDeleted, wantDeleted)
+				}
+			}
+
+			if tt.wantContent != "" {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != tt.wantContent {
+					t.Errorf("journal after replay = %q, want %q", content, tt.wantContent)
+				}
+			}
+		})
+	}
+}
+
+func TestFileRepositoryCompaction(t *testing.T) {
+	middleware.Initialize()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+	options := FileRepositoryOptions{SyncPolicy: SyncAlways, CompactAfter: 5}
+	repo, err := NewFileRepository(path, DedupeGlobal, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Add(domain.NewURL("keep", "https://keep.example/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		original := "https://keep.example/" + strings.Repeat("x", i)
+		if err := repo.Update(ctx, domain.NewURL("keep", original, "user", false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Add(domain.NewURL("gone", "https://gone.example/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.DeleteURLBatch(ctx, []UserShortURL{{UserID: "user", ShortURL: "gone"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, records, err := ReplayURLJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records > len(storage)+options.CompactAfter {
+		t.Errorf("journal has %d records for %d urls, compaction did not run", records, len(storage))
+	}
+	if got := storage["keep"].OriginalURL; got != "https://keep.example/"+strings.Repeat("x", 9) {
+		t.Errorf("keep.OriginalURL = %s", got)
+	}
+	if !storage["gone"].IsDeleted {
+		t.Error("gone is not deleted after compaction")
+	}
+}
+
+func TestFileRepositoryRecoversTornSidecars(t *testing.T) {
+	middleware.Initialize()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+	sidecars := map[string]string{
+		clicksFileName(path): `{"short_url":"a","clicked_at":"2026-01-02T10:00:00Z","ip_hash":"h1"}
+{"short_url":"a","clicked_at":"2026-01-02T11:00`,
+		deleteJobsFileName(path): `{"id":"j1","user_uuid":"u","status":"pending","attempts":0,"run_after":"2026-01-02T10:00:00Z","created_at":"2026-01-02T10:00:00Z","updated_at":"2026-01-02T10:00:00Z","items":[]}
+{"id":"j1","user_uuid":"u","status":"run`,
+		apiKeysFileName(path): `{"id":"k1","user_uuid":"u","name":"ci","key_hash":"hash1","prefix":"p1","created_at":"2026-01-02T10:00:00Z"}
+{"id":"k1","user_uuid":"u","name":"ci","key_hash":"hash1","prefix":"p1","created_at":"2026-01-02T10:00:00Z","revoked_at":"2026-01-0`,
+	}
+	for name, content := range sidecars {
+		if err := os.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := NewFileRepository(path, DedupeGlobal, FileRepositoryOptions{SyncPolicy: SyncAlways})
+	if err != nil {
+		t.Fatalf("NewFileRepository() with torn last lines: %v", err)
+	}
+	defer repo.Close()
+
+	stats, err := repo.GetClickStats(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalClicks != 1 {
+		t.Errorf("TotalClicks = %d, want 1", stats.TotalClicks)
+	}
+	if job, err := repo.GetDeleteJob(ctx, "j1"); err != nil || job.Status != domain.DeleteJobPending {
+		t.Errorf("GetDeleteJob() = %+v, %v, want pending job", job, err)
+	}
+	if key, err := repo.GetAPIKeyByHash(ctx, "hash1"); err != nil || key.RevokedAt != nil {
+		t.Errorf("GetAPIKeyByHash() = %+v, %v, want active key", key, err)
+	}
+	for name := range sidecars {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(content), "}\n") {
+			t.Errorf("%s was not truncated to the last complete record: %q", name, content)
+		}
+	}
+}
+
+func TestFileRepositoryDeleteJobCompaction(t *testing.T) {
+	middleware.Initialize()
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "storage.json")
+	options := FileRepositoryOptions{SyncPolicy: SyncNever, CompactAfter: 3}
+	repo, err := NewFileRepository(path, DedupeGlobal, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	old := domain.NewDeleteJob("old", "user", nil, now.Add(-2*deleteJobRetention))
+	old.Status = domain.DeleteJobDone
+	if err := repo.AddDeleteJob(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddDeleteJob(ctx, domain.NewDeleteJob("active", "user", []string{"a"}, now)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		job, err := repo.ClaimDeleteJob(ctx, now.Add(time.Duration(i)*time.Hour), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.ID != "active" {
+			t.Fatalf("ClaimDeleteJob() = %+v, want active", job)
+		}
+	}
+	if _, err := repo.GetDeleteJob(ctx, "old"); !errors.Is(err, errs.ErrJobNotFound) {
+		t.Errorf("finished job past retention: GetDeleteJob() error = %v, want %v", err, errs.ErrJobNotFound)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := ReadDeleteJobFile(deleteJobsFileName(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) > 1+options.CompactAfter {
+		t.Errorf("job log has %d snapshots for 1 job, compaction did not run", len(models))
+	}
+	if last := models[len(models)-1]; last.ID != "active" || last.Attempts != 10 {
+		t.Errorf("last snapshot = %s/%d attempts, want active/10", last.ID, last.Attempts)
+	}
+	for _, model := range models {
+		if model.ID == "old" {
+			t.Error("job past retention survived compaction")
+		}
+	}
+}
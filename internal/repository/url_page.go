@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"sort"
+	"strings"
+	"time"
+)
+
+// URLCursor — позиция keyset-пагинации: ссылка, на которой закончилась предыдущая страница.
+// short_url разрешает совпадения created_at.
+type URLCursor struct {
+	CreatedAt time.Time
+	ShortURL  string
+}
+
+type URLPageQuery struct {
+	UserID string
+	// Limit — максимальный размер страницы, 0 снимает ограничение.
+	Limit      int
+	After      *URLCursor
+	Descending bool
+	// IncludeDeleted включает и удалённые, и истёкшие к моменту Now ссылки: пока
+	// очистка до них не дошла, истёкшие ничем не отличаются от удалённых.
+	IncludeDeleted bool
+	Now            time.Time
+	// Search — подстрока original_url, с учётом регистра.
+	Search        string
+	Tag           string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+func (q URLPageQuery) matches(url *domain.URL) bool {
+	if url.UserID != q.UserID || ((url.IsDeleted || url.IsExpired(q.Now)) && !q.IncludeDeleted) {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(url.OriginalURL, q.Search) {
+		return false
+	}
+	if q.Tag != "" && !hasTag(url.Tags, q.Tag) {
+		return false
+	}
+	if q.CreatedAfter != nil && !url.CreatedAt.After(*q.CreatedAfter) {
+		return false
+	}
+	if q.CreatedBefore != nil && !url.CreatedAt.Before(*q.CreatedBefore) {
+		return false
+	}
+	if q.After != nil {
+		position := URLCursor{CreatedAt: url.CreatedAt, ShortURL: url.ID}
+		if q.Descending {
+			return cursorLess(position, *q.After)
+		}
+		return cursorLess(*q.After, position)
+	}
+	return true
+}
+
+func cursorLess(a, b URLCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ShortURL < b.ShortURL
+}
+
+// pageURLs отбирает страницу из ссылок в памяти так же, как SQL-хранилища.
+func pageURLs(urls []domain.URL, query URLPageQuery) []domain.URL {
+	var page []domain.URL
+	for i := range urls {
+		if query.matches(&urls[i]) {
+			page = append(page, urls[i])
+		}
+	}
+
+	sort.Slice(page, func(i, j int) bool {
+		a := URLCursor{CreatedAt: page[i].CreatedAt, ShortURL: page[i].ID}
+		b := URLCursor{CreatedAt: page[j].CreatedAt, ShortURL: page[j].ID}
+		if query.Descending {
+			return cursorLess(b, a)
+		}
+		return cursorLess(a, b)
+	})
+
+	if query.Limit > 0 && len(page) > query.Limit {
+		page = page[:query.Limit]
+	}
+	return page
+}
+
+// ensureCreatedAt проставляет время создания ссылке, пришедшей без него. Точность
+// ограничена микросекундами, как в Postgres, чтобы курсоры совпадали во всех хранилищах.
+func ensureCreatedAt(url *domain.URL) time.Time {
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	}
+	return url.CreatedAt
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetURLsPage(t *testing.T) {
+	middleware.Initialize()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, newRepo := range testBackends() {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+
+			expiresAt := start.Add(10 * time.Minute)
+			add := func(id, originalURL, userID string, minutes int) {
+				ctx := context.WithValue(context.Background(), middleware.UserID{}, userID)
+				url := domain.NewURL(id, originalURL, userID, false)
+				url.CreatedAt = start.Add(time.Duration(minutes) * time.Minute)
+				if id == "f" {
+					url.ExpiresAt = &expiresAt
+				}
+				if err := repo.Add(url, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// b и c созданы одновременно: порядок между ними задаёт short_url
+			add("a", "https://example.com/docs", "user", 0)
+			add("c", "https://example.com/blog", "user", 1)
+			add("b", "https://example.org/docs", "user", 1)
+			add("d", "https://example.net/", "user", 2)
+			add("e", "https://example.com/deleted", "user", 3)
+			add("f", "https://example.io/expiring", "user", 4)
+			add("x", "https://other.example/", "another", 1)
+			if _, err := repo.DeleteURLBatch(context.Background(), []UserShortURL{{UserID: "user", ShortURL: "e"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			ids := func(query URLPageQuery) []string {
+				t.Helper()
+				urls, err := repo.GetURLsPage(context.Background(), query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result := []string{}
+				for _, url := range urls {
+					result = append(result, url.ID)
+				}
+				return result
+			}
+			cursor := func(id string, minutes int) *URLCursor {
+				return &URLCursor{CreatedAt: start.Add(time.Duration(minutes) * time.Minute), ShortURL: id}
+			}
+			after := start.Add(30 * time.Second)
+			before := start.Add(2 * time.Minute)
+
+			tests := []struct {
+				name  string
+				query URLPageQuery
+				want  []string
+			}{
+				{name: "first page", query: URLPageQuery{UserID: "user", Limit: 2}, want: []string{"a", "b"}},
+				{name: "next page", query: URLPageQuery{UserID: "user", Limit: 2, After: cursor("b", 1)}, want: []string{"c", "d"}},
+				{name: "descending", query: URLPageQuery{UserID: "user", Descending: true, After: cursor("c", 1)}, want: []string{"b", "a"}},
+				{name: "include deleted", query: URLPageQuery{UserID: "user", IncludeDeleted: true, After: cursor("c", 1)}, want: []string{"d", "e", "f"}},
+				{name: "before expiry", query: URLPageQuery{UserID: "user", Now: start, After: cursor("d", 2)}, want: []string{"f"}},
+				{name: "expired hidden", query: URLPageQuery{UserID: "user", Now: expiresAt, After: cursor("d", 2)}, want: []string{}},
+				{name: "expired included", query: URLPageQuery{UserID: "user", Now: expiresAt, IncludeDeleted: true, After: cursor("d", 2)}, want: []string{"e", "f"}},
+				{name: "search", query: URLPageQuery{UserID: "user", Search: "example.com", IncludeDeleted: true}, want: []string{"a", "c", "e"}},
+				{name: "created range", query: URLPageQuery{UserID: "user", CreatedAfter: &after, CreatedBefore: &before}, want: []string{"b", "c"}},
+			}
+			for _, tt := range tests {
+				if got := ids(tt.query); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: GetURLsPage() = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+
+			urls, err := repo.GetURLsPage(context.Background(), URLPageQuery{UserID: "user", Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !urls[0].CreatedAt.Equal(start) {
+				t.Errorf("CreatedAt = %v, want %v", urls[0].CreatedAt, start)
+			}
+		})
+	}
+}
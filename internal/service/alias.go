@@ -0,0 +1,39 @@
+package service
+
+import (
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"strings"
+)
+
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 64
+)
+
+// reservedAliases пересекаются с маршрутами роутера и не могут быть короткими ссылками.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"metrics": {},
+	"ping":    {},
+}
+
+func ValidateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return errs.NewInvalidAlias(alias, fmt.Sprintf("length must be between %d and %d", aliasMinLength, aliasMaxLength))
+	}
+
+	for _, c := range alias {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '-' && c != '_' {
+			return errs.NewInvalidAlias(alias, "only latin letters, digits, '-' and '_' are allowed")
+		}
+	}
+
+	if _, reserved := reservedAliases[strings.ToLower(alias)]; reserved {
+		return errs.NewInvalidAlias(alias, "alias is reserved")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"strings"
+	"testing"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{name: "valid alias", alias: "spring-sale", wantErr: false},
+		{name: "valid alias with underscore", alias: "Spring_2024", wantErr: false},
+		{name: "too short", alias: "ab", wantErr: true},
+		{name: "too long", alias: strings.Repeat("a", 65), wantErr: true},
+		{name: "forbidden characters", alias: "spring/sale", wantErr: true},
+		{name: "non latin characters", alias: "весна", wantErr: true},
+		{name: "reserved word", alias: "api", wantErr: true},
+		{name: "reserved word in upper case", alias: "PING", wantErr: true},
+		{name: "metrics route", alias: "metrics", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAlias(%q) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+			if err != nil {
+				if invalidAliasErr := new(errs.InvalidAlias); !errors.As(err, &invalidAliasErr) {
+					t.Errorf("ValidateAlias(%q) returned %T, want *errs.InvalidAlias", tt.alias, err)
+				}
+			}
+		})
+	}
+}
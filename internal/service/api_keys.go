@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"github.com/pervukhinpm/link-shortener.git/internal/utils"
+	"time"
+)
+
+const (
+	apiKeyPrefix       = "sk_"
+	apiKeyRandomLength = 40
+	apiKeyShownPrefix  = 10
+	apiKeyMaxNameLen   = 100
+)
+
+type APIKeyServiceManager interface {
+	Create(ctx context.Context, name string, scopes []string) (*domain.APIKey, string, error)
+	List(ctx context.Context) ([]domain.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type APIKeyService struct {
+	repo      repository.Repository
+	generator *RandomGenerator
+}
+
+func NewAPIKeyService(repo repository.Repository) *APIKeyService {
+	generator, _ := NewRandomGenerator(apiKeyRandomLength)
+	return &APIKeyService{repo: repo, generator: generator}
+}
+
+// Create возвращает ключ в открытом виде единственный раз, в хранилище попадает только его хеш.
+func (s *APIKeyService) Create(ctx context.Context, name string, scopes []string) (*domain.APIKey, string, error) {
+	if len(name) > apiKeyMaxNameLen {
+		return nil, "", fmt.Errorf("%w: name is longer than %d characters", errs.ErrInvalidAPIKey, apiKeyMaxNameLen)
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return nil, "", fmt.Errorf("%w: unknown scope %q", errs.ErrInvalidAPIKey, scope)
+		}
+	}
+
+	id, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, "", err
+	}
+	random, err := s.generator.Generate()
+	if err != nil {
+		return nil, "", err
+	}
+	rawKey := apiKeyPrefix + random
+
+	key := &domain.APIKey{
+		ID:        id,
+		UserID:    middleware.GetUserID(ctx),
+		Name:      name,
+		KeyHash:   hashAPIKey(rawKey),
+		Prefix:    rawKey[:apiKeyShownPrefix],
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repo.AddAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, rawKey, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context) ([]domain.APIKey, error) {
+	return s.repo.GetAPIKeysByUser(ctx, middleware.GetUserID(ctx))
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	return s.repo.RevokeAPIKey(ctx, middleware.GetUserID(ctx), id, time.Now().UTC())
+}
+
+// ResolveAPIKey реализует middleware.APIKeyResolver.
+func (s *APIKeyService) ResolveAPIKey(ctx context.Context, rawKey string) (*domain.APIKey, error) {
+	key, err := s.repo.GetAPIKeyByHash(ctx, hashAPIKey(rawKey))
+	if err != nil {
+		return nil, err
+	}
+	if key.IsRevoked() {
+		return nil, errs.ErrAPIKeyRevoked
+	}
+	return key, nil
+}
+
+// Ключи генерируются с высокой энтропией, поэтому медленный хеш вроде bcrypt не нужен.
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range domain.AllScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
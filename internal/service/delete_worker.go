@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"time"
+)
+
+const (
+	deleteJobMaxAttempts  = 5
+	deleteJobLease        = time.Minute
+	deleteJobPollInterval = 500 * time.Millisecond
+	deleteJobRetryDelay   = 2 * time.Second
+)
+
+// DeleteWorker разбирает очередь задач удаления. Задача, не завершённая за время аренды
+// (например, из-за падения процесса), снова становится доступной для захвата.
+type DeleteWorker struct {
+	repo repository.Repository
+}
+
+func NewDeleteWorker(repo repository.Repository) *DeleteWorker {
+	return &DeleteWorker{repo: repo}
+}
+
+func (w *DeleteWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(deleteJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.processAvailable(ctx)
+		}
+	}
+}
+
+func (w *DeleteWorker) processAvailable(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.repo.ClaimDeleteJob(ctx, time.Now(), deleteJobLease)
+		if err != nil {
+			middleware.Log.Errorw("failed to claim delete job", "error", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		w.process(job)
+	}
+}
+
+func (w *DeleteWorker) process(job *domain.DeleteJob) {
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var pending []string
+	for _, item := range job.Items {
+		if item.Status == domain.DeleteItemPending {
+			pending = append(pending, item.ShortURL)
+		}
+	}
+
+	formedToDelete := formDeleteTasks(model.DeleteBatch{ShortenedURL: pending, UserID: job.UserID})
+	deleted, err := w.repo.DeleteURLBatch(ctxWithTimeout, formedToDelete)
+
+	now := time.Now()
+	job.UpdatedAt = now
+	if err != nil {
+		middleware.Log.Errorw("delete job attempt failed", "job_id", job.ID, "attempt", job.Attempts, "error", err)
+		job.LastError = err.Error()
+		if job.Attempts >= deleteJobMaxAttempts {
+			job.Status = domain.DeleteJobFailed
+		} else {
+			job.Status = domain.DeleteJobPending
+			job.RunAfter = now.Add(time.Duration(job.Attempts) * deleteJobRetryDelay)
+		}
+	} else {
+		deletedSet := make(map[string]struct{}, len(deleted))
+		for _, shortURL := range deleted {
+			deletedSet[shortURL] = struct{}{}
+		}
+		for i, item := range job.Items {
+			if item.Status != domain.DeleteItemPending {
+				continue
+			}
+			if _, ok := deletedSet[item.ShortURL]; ok {
+				job.Items[i].Status = domain.DeleteItemDeleted
+			} else {
+				job.Items[i].Status = domain.DeleteItemNotFound
+			}
+		}
+		job.Status = domain.DeleteJobDone
+		job.LastError = ""
+	}
+
+	if err := w.repo.SaveDeleteJob(ctxWithTimeout, job); err != nil {
+		middleware.Log.Errorw("failed to save delete job", "job_id", job.ID, "error", err)
+	}
+}
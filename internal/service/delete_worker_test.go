@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"testing"
+)
+
+func TestDeleteWorkerProcessesJob(t *testing.T) {
+	middleware.Initialize()
+	ctx := context.Background()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	if err := repo.Add(domain.NewURL("owned", "https://practicum.yandex.ru/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(domain.NewURL("foreign", "https://yandex.ru/", "another", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewURLService(repo, NewSequentialGenerator(0), repository.DedupeGlobal, canonical.Options{}, nil)
+	job, err := s.DeleteURLBatch(ctx, model.DeleteBatch{
+		ShortenedURL: []string{"owned", "foreign", "owned"},
+		UserID:       "user",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	NewDeleteWorker(repo).processAvailable(ctx)
+
+	processed, err := repo.GetDeleteJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.Status != domain.DeleteJobDone {
+		t.Fatalf("job status = %s, want %s", processed.Status, domain.DeleteJobDone)
+	}
+
+	want := map[string]string{"owned": domain.DeleteItemDeleted, "foreign": domain.DeleteItemNotFound}
+	if len(processed.Items) != len(want) {
+		t.Fatalf("job has %d items, want %d", len(processed.Items), len(want))
+	}
+	for _, item := range processed.Items {
+		if item.Status != want[item.ShortURL] {
+			t.Errorf("item %s status = %s, want %s", item.ShortURL, item.Status, want[item.ShortURL])
+		}
+	}
+
+	owned, err := repo.Get("owned", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !owned.IsDeleted {
+		t.Error("owned url was not deleted")
+	}
+	foreign, err := repo.Get("foreign", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foreign.IsDeleted {
+		t.Error("foreign url must not be deleted")
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"time"
+)
+
+// ResolveExpiry превращает expires_at или ttl (в секундах) из запроса в момент истечения ссылки.
+// Если не задано ни то, ни другое, ссылка бессрочная и возвращается nil.
+func ResolveExpiry(expiresAt *time.Time, ttl int64, now time.Time) (*time.Time, error) {
+	if expiresAt != nil && ttl != 0 {
+		return nil, fmt.Errorf("%w: expires_at and ttl are mutually exclusive", errs.ErrInvalidExpiry)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("%w: ttl must be positive", errs.ErrInvalidExpiry)
+	}
+	if ttl > 0 {
+		expires := now.Add(time.Duration(ttl) * time.Second).UTC()
+		return &expires, nil
+	}
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", errs.ErrInvalidExpiry)
+		}
+		expires := expiresAt.UTC()
+		return &expires, nil
+	}
+	return nil, nil
+}
+
+// ExpirationReaper периодически помечает истёкшие ссылки удалёнными. Пометка лишь
+// закрепляет уже наступившее состояние: Resolve, Update и список ссылок считают
+// истёкшую ссылку удалённой с момента истечения, независимо от очистки.
+type ExpirationReaper struct {
+	repo     repository.Repository
+	interval time.Duration
+}
+
+func NewExpirationReaper(repo repository.Repository, interval time.Duration) *ExpirationReaper {
+	return &ExpirationReaper{repo: repo, interval: interval}
+}
+
+// Run с неположительным интервалом сразу возвращается: истёкшие ссылки и без
+// очистки не открываются, Resolve проверяет срок сам.
+func (r *ExpirationReaper) Run(ctx context.Context) {
+	if r.interval <= 0 {
+		middleware.Log.Infow("expired urls cleanup disabled", "interval", r.interval)
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *ExpirationReaper) reap(ctx context.Context) {
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	count, err := r.repo.DeleteExpired(ctxWithTimeout, time.Now())
+	if err != nil {
+		middleware.Log.Errorw("failed to delete expired urls", "error", err)
+		return
+	}
+	if count > 0 {
+		middleware.Log.Infow("expired urls deleted", "count", count)
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestExpirationReaperDisabled(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			NewExpirationReaper(repo, interval).Run(context.Background())
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Run() with interval %v did not return", interval)
+		}
+	}
+}
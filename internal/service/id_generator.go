@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	GeneratorRandom     = "random"
+	GeneratorSequential = "sequential"
+	GeneratorHashids    = "hashids"
+	GeneratorWords      = "words"
+)
+
+type IDGenerator interface {
+	Generate() (string, error)
+}
+
+func NewIDGenerator(strategy string, length int, salt string) (IDGenerator, error) {
+	// Счётчики стартуют с текущего времени, чтобы после рестарта не повторять уже выданные ID
+	start := uint64(time.Now().UnixMilli())
+
+	switch strategy {
+	case "", GeneratorRandom:
+		return NewRandomGenerator(length)
+	case GeneratorSequential:
+		return NewSequentialGenerator(start), nil
+	case GeneratorHashids:
+		return NewHashidsGenerator(start, salt), nil
+	case GeneratorWords:
+		return NewWordsGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unknown id generator strategy: %s", strategy)
+	}
+}
+
+func encodeBase62(n uint64, alphabet string) string {
+	if n == 0 {
+		return string(alphabet[0])
+	}
+	var sb strings.Builder
+	base := uint64(len(alphabet))
+	for n > 0 {
+		sb.WriteByte(alphabet[n%base])
+		n /= base
+	}
+	encoded := []byte(sb.String())
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+type RandomGenerator struct {
+	length int
+}
+
+func NewRandomGenerator(length int) (*RandomGenerator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("id length must be positive, got %d", length)
+	}
+	return &RandomGenerator{length: length}, nil
+}
+
+func (g *RandomGenerator) Generate() (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+	id := make([]byte, g.length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = base62Alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
+
+type SequentialGenerator struct {
+	counter atomic.Uint64
+}
+
+func NewSequentialGenerator(start uint64) *SequentialGenerator {
+	g := &SequentialGenerator{}
+	g.counter.Store(start)
+	return g
+}
+
+func (g *SequentialGenerator) Generate() (string, error) {
+	return encodeBase62(g.counter.Add(1), base62Alphabet), nil
+}
+
+// HashidsGenerator выдаёт ID по счётчику, но так, чтобы соседние значения не были похожи друг на друга:
+// счётчик перемешивается биективным умножением, а алфавит переставляется в зависимости от соли.
+type HashidsGenerator struct {
+	counter  atomic.Uint64
+	alphabet string
+}
+
+// hashidsMultiplier нечётный, поэтому умножение по модулю 2^64 обратимо и не даёт коллизий.
+const hashidsMultiplier = 0x9E3779B97F4A7C15
+
+func NewHashidsGenerator(start uint64, salt string) *HashidsGenerator {
+	g := &HashidsGenerator{alphabet: shuffleAlphabet(base62Alphabet, salt)}
+	g.counter.Store(start)
+	return g
+}
+
+func (g *HashidsGenerator) Generate() (string, error) {
+	return encodeBase62(g.counter.Add(1)*hashidsMultiplier, g.alphabet), nil
+}
+
+func shuffleAlphabet(alphabet string, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	shuffled := []byte(alphabet)
+	seed := sha256.Sum256([]byte(salt))
+	state := binary.BigEndian.Uint64(seed[:8])
+	for i := len(shuffled) - 1; i > 0; i-- {
+		// xorshift64 — детерминированный ГПСЧ, чтобы перестановка зависела только от соли
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		j := int(state % uint64(i+1))
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return string(shuffled)
+}
+
+var (
+	wordsAdjectives = []string{
+		"able", "amber", "apt", "bold", "brave", "brisk", "calm", "clever",
+		"cool", "cozy", "crisp", "daring", "eager", "early", "fair", "fancy",
+		"fast", "fierce", "fine", "fresh", "gentle", "glad", "golden", "grand",
+		"happy", "hardy", "jolly", "keen", "kind", "lively", "lucky", "mellow",
+		"merry", "mighty", "modest", "neat", "noble", "polite", "proud", "quick",
+		"quiet", "rapid", "ready", "rosy", "royal", "shiny", "silent", "silver",
+		"smart", "snowy", "solid", "sunny", "swift", "tidy", "tiny", "vivid",
+		"warm", "wild", "wise", "witty", "young", "zesty", "zippy", "sturdy",
+	}
+	wordsNouns = []string{
+		"badger", "bear", "beaver", "bison", "cat", "cobra", "condor", "crane",
+		"deer", "dingo", "dolphin", "eagle", "falcon", "ferret", "finch", "fox",
+		"gecko", "goat", "hare", "hawk", "heron", "horse", "ibis", "jaguar",
+		"koala", "lemur", "lion", "lynx", "marten", "mole", "moose", "newt",
+		"otter", "owl", "panda", "parrot", "pelican", "penguin", "puma", "quail",
+		"rabbit", "raven", "robin", "seal", "shark", "sloth", "sparrow", "squid",
+		"swan", "tiger", "toad", "trout", "turtle", "viper", "walrus", "weasel",
+		"whale", "wolf", "wombat", "yak", "zebra", "orca", "bee", "crab",
+	}
+)
+
+// WordsGenerator собирает читаемые ID вида "brave-otter-42". Числовой суффикс увеличивает
+// количество комбинаций, чтобы повторные попытки при коллизиях не заканчивались слишком быстро.
+type WordsGenerator struct{}
+
+func NewWordsGenerator() *WordsGenerator {
+	return &WordsGenerator{}
+}
+
+func (g *WordsGenerator) Generate() (string, error) {
+	adjective, err := randomIndex(len(wordsAdjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomIndex(len(wordsNouns))
+	if err != nil {
+		return "", err
+	}
+	suffix, err := randomIndex(100)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%d", wordsAdjectives[adjective], wordsNouns[noun], suffix), nil
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"strings"
+	"testing"
+)
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+	}{
+		{name: "random", strategy: GeneratorRandom},
+		{name: "sequential", strategy: GeneratorSequential},
+		{name: "hashids", strategy: GeneratorHashids},
+		{name: "words", strategy: GeneratorWords},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewIDGenerator(tt.strategy, 8, "salt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]struct{})
+			for i := 0; i < 100; i++ {
+				id, err := g.Generate()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.ContainsAny(id, "_/+=") {
+					t.Errorf("generated id %q contains forbidden characters", id)
+				}
+				seen[id] = struct{}{}
+			}
+			if tt.strategy != GeneratorWords && len(seen) != 100 {
+				t.Errorf("generated %d unique ids, want 100", len(seen))
+			}
+		})
+	}
+
+	if _, err := NewIDGenerator("unknown", 8, ""); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+type stubGenerator struct {
+	ids []string
+}
+
+func (g *stubGenerator) Generate() (string, error) {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+func TestShortenRetriesOnCollision(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	if err := repo.Add(domain.NewURL("taken", "https://practicum.yandex.ru/", "", false), context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewURLService(repo, &stubGenerator{ids: []string{"taken", "fresh"}}, repository.DedupeGlobal, canonical.Options{}, nil)
+	url, err := s.Shorten("https://yandex.ru/", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url.ID != "fresh" {
+		t.Errorf("got id %q, want %q", url.ID, "fresh")
+	}
+}
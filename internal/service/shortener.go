@@ -2,57 +2,275 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
+	"fmt"
 	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
 	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
 	"github.com/pervukhinpm/link-shortener.git/internal/model"
 	"github.com/pervukhinpm/link-shortener.git/internal/repository"
-	"strings"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
+	"github.com/pervukhinpm/link-shortener.git/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"sync"
 	"time"
 )
 
 type ShortenerServiceReaderWriter interface {
 	Find(id string, ctx context.Context) (*domain.URL, error)
-	AddBatch(urls []domain.URL, ctx context.Context) error
+	Resolve(ctx context.Context, shortURL string) (*domain.URL, error)
+	ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchItemResult, error)
 	Shorten(original string, ctx context.Context) (*domain.URL, error)
-	GetByUserID(ctx context.Context) (*[]domain.URL, error)
-	DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch)
-	GetFlagByShortURL(ctx context.Context, shortURL string) (bool, error)
+	ShortenWithOptions(original string, options ShortenOptions, ctx context.Context) (*domain.URL, error)
+	ListUserURLs(ctx context.Context, options ListURLsOptions) (*URLPage, error)
+	DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch) (*domain.DeleteJob, error)
+	GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error)
+	Update(ctx context.Context, shortURL string, options UpdateOptions) (*domain.URL, error)
 }
 
+// maxGenerateAttempts ограничивает число повторных генераций ID при коллизиях в репозитории.
+const maxGenerateAttempts = 5
+
 type ShortenerService struct {
-	repo repository.Repository
+	repo        repository.Repository
+	idGenerator IDGenerator
+	// dedupeScope — область дедупликации хранилища; с repository.DedupeNone
+	// одинаковые original_url в пакете не схлопываются.
+	dedupeScope string
+	// canonicalOptions задаёт, как приводится URL перед поиском дублей.
+	canonicalOptions canonical.Options
+	// validator проверяет URL до канонизации; nil отключает проверку.
+	validator *URLValidator
+}
+
+func NewURLService(
+	repo repository.Repository,
+	idGenerator IDGenerator,
+	dedupeScope string,
+	canonicalOptions canonical.Options,
+	validator *URLValidator,
+) *ShortenerService {
+	return &ShortenerService{
+		repo:             repo,
+		idGenerator:      idGenerator,
+		dedupeScope:      dedupeScope,
+		canonicalOptions: canonicalOptions,
+		validator:        validator,
+	}
+}
+
+// canonicalize проверяет URL и возвращает его канонический вид; ошибки — *errs.InvalidURL.
+func (u *ShortenerService) canonicalize(original string) (string, error) {
+	if u.validator != nil {
+		if err := u.validator.Validate(original); err != nil {
+			return "", err
+		}
+	}
+	canonicalURL, err := canonical.Canonicalize(original, u.canonicalOptions)
+	if err != nil {
+		return "", errs.NewInvalidURL(original, errs.URLRuleMalformed, err.Error())
+	}
+	return canonicalURL, nil
 }
 
-func NewURLService(repo repository.Repository) *ShortenerService {
-	return &ShortenerService{repo: repo}
+type ShortenOptions struct {
+	Alias     string
+	ExpiresAt *time.Time
+	TTL       int64
+	Tags      []string
 }
 
 func (u *ShortenerService) Shorten(original string, ctx context.Context) (*domain.URL, error) {
-	userID := middleware.GetUserID(ctx)
-	randomBytes := make([]byte, 6)
-	if _, err := rand.Read(randomBytes); err != nil {
+	return u.ShortenWithOptions(original, ShortenOptions{}, ctx)
+}
+
+func (u *ShortenerService) ShortenWithOptions(original string, options ShortenOptions, ctx context.Context) (_ *domain.URL, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.ShortenWithOptions")
+	defer func() { tracing.End(span, err) }()
+
+	expiresAt, err := ResolveExpiry(options.ExpiresAt, options.TTL, time.Now())
+	if err != nil {
 		return nil, err
 	}
-	short := base64.URLEncoding.EncodeToString(randomBytes)
-	short = strings.TrimRight(short, "=")
-	url := domain.NewURL(short, original, userID, false)
-	if err := u.repo.Add(url, ctx); err != nil {
+	tags, err := NormalizeTags(options.Tags)
+	if err != nil {
 		return nil, err
 	}
-	return url, nil
+	canonicalURL, err := u.canonicalize(original)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := middleware.GetUserID(ctx)
+
+	if options.Alias != "" {
+		if err := ValidateAlias(options.Alias); err != nil {
+			return nil, err
+		}
+		url := domain.NewURL(options.Alias, original, userID, false)
+		url.CanonicalURL = canonicalURL
+		url.ExpiresAt = expiresAt
+		url.Tags = tags
+		if err := u.repo.Add(url, ctx); err != nil {
+			return nil, err
+		}
+		return url, nil
+	}
+
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		short, err := u.idGenerator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		url := domain.NewURL(short, original, userID, false)
+		url.CanonicalURL = canonicalURL
+		url.ExpiresAt = expiresAt
+		url.Tags = tags
+		err = u.repo.Add(url, ctx)
+		if err == nil {
+			return url, nil
+		}
+		if collisionErr := new(errs.ShortURLAlreadyExists); errors.As(err, &collisionErr) {
+			middleware.LogFromContext(ctx).Infow("short id collision, regenerating", "id", short, "attempt", attempt+1)
+			continue
+		}
+		return nil, err
+	}
+	return nil, fmt.Errorf("failed to generate unique short id after %d attempts", maxGenerateAttempts)
+}
+
+type BatchItem struct {
+	// CorrelationID нужен только клиенту, чтобы сопоставить элементы ответа с запросом.
+	CorrelationID string
+	OriginalURL   string
+	ExpiresAt     *time.Time
+	TTL           int64
+	Tags          []string
+}
+
+type BatchItemResult struct {
+	CorrelationID string
+	// Status — model.BatchItemCreated, model.BatchItemExisted или model.BatchItemInvalid.
+	Status string
+	// URL — созданная или уже существовавшая ссылка, для невалидных элементов nil.
+	URL *domain.URL
+	Err error
 }
 
-func (u *ShortenerService) AddBatch(urls []domain.URL, ctx context.Context) error {
-	if err := u.repo.AddBatch(urls, ctx); err != nil {
-		return err
+// ShortenBatch создаёт ссылки для пакета с ID из того же генератора, что и Shorten.
+// Невалидные элементы отклоняются по отдельности, повторы URL внутри пакета (с учётом
+// канонизации) сохраняются один раз, а элементы с коллизией ID перегенерируются.
+func (u *ShortenerService) ShortenBatch(ctx context.Context, items []BatchItem) (_ []BatchItemResult, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.ShortenBatch", attribute.Int("batch.size", len(items)))
+	defer func() { tracing.End(span, err) }()
+
+	userID := middleware.GetUserID(ctx)
+	now := time.Now()
+
+	results := make([]BatchItemResult, len(items))
+	// pending — индексы первых вхождений URL, которые ещё нужно сохранить
+	var pending []int
+	firstByCanonical := make(map[string]int)
+	duplicates := make(map[int]int)
+	seenCorrelationIDs := make(map[string]bool)
+	for i, item := range items {
+		results[i].CorrelationID = item.CorrelationID
+		if item.CorrelationID != "" && seenCorrelationIDs[item.CorrelationID] {
+			results[i].Status = model.BatchItemInvalid
+			results[i].Err = errs.ErrDuplicateCorrelationID
+			continue
+		}
+		seenCorrelationIDs[item.CorrelationID] = true
+
+		if item.OriginalURL == "" {
+			results[i].Status = model.BatchItemInvalid
+			results[i].Err = errs.ErrEmptyURL
+			continue
+		}
+		expiresAt, err := ResolveExpiry(item.ExpiresAt, item.TTL, now)
+		if err != nil {
+			results[i].Status = model.BatchItemInvalid
+			results[i].Err = err
+			continue
+		}
+		tags, err := NormalizeTags(item.Tags)
+		if err != nil {
+			results[i].Status = model.BatchItemInvalid
+			results[i].Err = err
+			continue
+		}
+		canonicalURL, err := u.canonicalize(item.OriginalURL)
+		if err != nil {
+			results[i].Status = model.BatchItemInvalid
+			results[i].Err = err
+			continue
+		}
+
+		if u.dedupeScope != repository.DedupeNone {
+			if first, ok := firstByCanonical[canonicalURL]; ok {
+				duplicates[i] = first
+				continue
+			}
+			firstByCanonical[canonicalURL] = i
+		}
+		results[i].URL = domain.NewURL("", item.OriginalURL, userID, false)
+		results[i].URL.CanonicalURL = canonicalURL
+		results[i].URL.ExpiresAt = expiresAt
+		results[i].URL.Tags = tags
+		pending = append(pending, i)
 	}
-	return nil
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == maxGenerateAttempts {
+			return nil, fmt.Errorf("failed to generate unique short ids after %d attempts", maxGenerateAttempts)
+		}
+
+		urls := make([]domain.URL, len(pending))
+		for j, i := range pending {
+			short, err := u.idGenerator.Generate()
+			if err != nil {
+				return nil, err
+			}
+			results[i].URL.ID = short
+			urls[j] = *results[i].URL
+		}
+
+		stored, err := u.repo.AddBatch(urls, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for j, i := range pending {
+			switch stored[j].Status {
+			case repository.BatchItemCreated:
+				results[i].Status = model.BatchItemCreated
+			case repository.BatchItemExisted:
+				results[i].Status = model.BatchItemExisted
+				results[i].URL.ID = stored[j].ShortURL
+			default:
+				retry = append(retry, i)
+			}
+		}
+		if len(retry) > 0 {
+			middleware.LogFromContext(ctx).Infow("short id collisions in batch, regenerating", "count", len(retry), "attempt", attempt+1)
+		}
+		pending = retry
+	}
+
+	for i, first := range duplicates {
+		url := *results[first].URL
+		results[i].Status = model.BatchItemExisted
+		results[i].URL = &url
+	}
+	return results, nil
 }
 
-func (u *ShortenerService) Find(id string, ctx context.Context) (*domain.URL, error) {
+func (u *ShortenerService) Find(id string, ctx context.Context) (_ *domain.URL, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.Find", attribute.String("short_url", id))
+	defer func() { tracing.End(span, err) }()
+
 	url, err := u.repo.Get(id, ctx)
 	if err != nil {
 		return nil, err
@@ -60,26 +278,137 @@ func (u *ShortenerService) Find(id string, ctx context.Context) (*domain.URL, er
 	return url, nil
 }
 
-func (u *ShortenerService) GetByUserID(ctx context.Context) (*[]domain.URL, error) {
-	url, err := u.repo.GetByUserID(ctx)
+// Resolve находит ссылку для редиректа одним обращением к хранилищу:
+// удалённые и истёкшие ссылки возвращают errs.ErrURLDeleted.
+func (u *ShortenerService) Resolve(ctx context.Context, shortURL string) (_ *domain.URL, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.Resolve", attribute.String("short_url", shortURL))
+	defer func() { tracing.End(span, err) }()
+
+	url, err := u.repo.Get(shortURL, ctx)
 	if err != nil {
 		return nil, err
 	}
+	if url.IsDeleted || url.IsExpired(time.Now()) {
+		return nil, errs.ErrURLDeleted
+	}
+	return url, nil
+}
+
+type UpdateOptions struct {
+	OriginalURL *string
+	ExpiresAt   *time.Time
+	TTL         int64
+	// ClearExpiry делает ссылку бессрочной; несовместим с ExpiresAt и TTL.
+	ClearExpiry bool
+	// Tags заменяет теги целиком; пустой список снимает все теги.
+	Tags *[]string
+}
+
+func (u *ShortenerService) Update(ctx context.Context, shortURL string, options UpdateOptions) (_ *domain.URL, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.Update", attribute.String("short_url", shortURL))
+	defer func() { tracing.End(span, err) }()
+
+	if options.OriginalURL == nil && options.ExpiresAt == nil && options.TTL == 0 && !options.ClearExpiry && options.Tags == nil {
+		return nil, fmt.Errorf("%w: nothing to update", errs.ErrInvalidUpdate)
+	}
+	if options.ClearExpiry && (options.ExpiresAt != nil || options.TTL != 0) {
+		return nil, fmt.Errorf("%w: expires_at: null and ttl are mutually exclusive", errs.ErrInvalidExpiry)
+	}
+	if options.OriginalURL != nil && *options.OriginalURL == "" {
+		return nil, fmt.Errorf("%w: original_url must not be empty", errs.ErrInvalidUpdate)
+	}
+	var tags []string
+	if options.Tags != nil {
+		if tags, err = NormalizeTags(*options.Tags); err != nil {
+			return nil, err
+		}
+	}
+	var canonicalURL string
+	if options.OriginalURL != nil {
+		if canonicalURL, err = u.canonicalize(*options.OriginalURL); err != nil {
+			return nil, err
+		}
+	}
+
+	url, err := u.repo.Get(shortURL, ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Чужая ссылка неотличима от несуществующей, чтобы по ответам нельзя было перебирать ID
+	if url.UserID != middleware.GetUserID(ctx) {
+		return nil, errs.ErrURLNotFound
+	}
+	// Истёкшая ссылка не продлевается: как и в Resolve, она считается удалённой,
+	// даже если фоновая очистка до неё ещё не дошла
+	if url.IsDeleted || url.IsExpired(time.Now()) {
+		return nil, errs.ErrURLDeleted
+	}
+
+	if options.OriginalURL != nil {
+		url.OriginalURL = *options.OriginalURL
+		url.CanonicalURL = canonicalURL
+	}
+	if options.ClearExpiry {
+		url.ExpiresAt = nil
+	} else if options.ExpiresAt != nil || options.TTL != 0 {
+		expiresAt, err := ResolveExpiry(options.ExpiresAt, options.TTL, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		url.ExpiresAt = expiresAt
+	}
+	if options.Tags != nil {
+		url.Tags = tags
+	}
+
+	if err := u.repo.Update(ctx, url); err != nil {
+		return nil, err
+	}
 	return url, nil
 }
 
-func (u *ShortenerService) GetFlagByShortURL(ctx context.Context, shortURL string) (bool, error) {
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// DeleteURLBatch ставит удаление в очередь, саму пометку ссылок удалёнными выполняет DeleteWorker.
+func (u *ShortenerService) DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch) (_ *domain.DeleteJob, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.DeleteURLBatch", attribute.Int("batch.size", len(deleteBatch.ShortenedURL)))
+	defer func() { tracing.End(span, err) }()
 
-	isDeleted, err := u.repo.GetFlagByShortURL(ctxWithTimeout, shortURL)
-	return isDeleted, err
+	jobID, err := utils.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(deleteBatch.ShortenedURL))
+	shortURLs := make([]string, 0, len(deleteBatch.ShortenedURL))
+	for _, shortURL := range deleteBatch.ShortenedURL {
+		if _, duplicate := seen[shortURL]; duplicate {
+			continue
+		}
+		seen[shortURL] = struct{}{}
+		shortURLs = append(shortURLs, shortURL)
+	}
+
+	job := domain.NewDeleteJob(jobID, deleteBatch.UserID, shortURLs, time.Now())
+	if err := u.repo.AddDeleteJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
 }
 
-func (u *ShortenerService) DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch) {
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (u *ShortenerService) GetDeleteJob(ctx context.Context, id string) (_ *domain.DeleteJob, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.GetDeleteJob", attribute.String("job.id", id))
+	defer func() { tracing.End(span, err) }()
 
+	job, err := u.repo.GetDeleteJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != middleware.GetUserID(ctx) {
+		return nil, errs.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func formDeleteTasks(deleteBatch model.DeleteBatch) []repository.UserShortURL {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
@@ -91,11 +420,7 @@ func (u *ShortenerService) DeleteURLBatch(ctx context.Context, deleteBatch model
 	for form := range formResultCh {
 		formedToDelete = append(formedToDelete, form)
 	}
-
-	err := u.repo.DeleteURLBatch(ctxWithTimeout, formedToDelete)
-	if err != nil {
-		return
-	}
+	return formedToDelete
 }
 
 func generator(doneCh chan struct{}, input model.DeleteBatch) chan DeleteTask {
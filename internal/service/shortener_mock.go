@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
 	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"time"
 )
 
 type MockShortenerService struct {
 	ShortenURL *domain.URL
+	ShortenErr error
+	UpdateErr  error
+	// LastUpdate — опции последнего вызова Update.
+	LastUpdate UpdateOptions
 }
 
 func NewMockService() *MockShortenerService {
@@ -16,12 +22,19 @@ func NewMockService() *MockShortenerService {
 }
 
 func (u *MockShortenerService) Shorten(original string, ctx context.Context) (*domain.URL, error) {
+	if u.ShortenErr != nil {
+		return nil, u.ShortenErr
+	}
 	if u.ShortenURL == nil {
 		return nil, errors.New("shorten service not found")
 	}
 	return u.ShortenURL, nil
 }
 
+func (u *MockShortenerService) ShortenWithOptions(original string, options ShortenOptions, ctx context.Context) (*domain.URL, error) {
+	return u.Shorten(original, ctx)
+}
+
 func (u *MockShortenerService) Find(id string, ctx context.Context) (*domain.URL, error) {
 	if u.ShortenURL == nil {
 		return nil, errors.New("shorten service not found")
@@ -29,26 +42,53 @@ func (u *MockShortenerService) Find(id string, ctx context.Context) (*domain.URL
 	return u.ShortenURL, nil
 }
 
-func (u *MockShortenerService) AddBatch(urls []domain.URL, ctx context.Context) error {
-	for _, url := range urls {
-		if _, err := u.Shorten(url.OriginalURL, ctx); err != nil {
-			return err
+func (u *MockShortenerService) Resolve(ctx context.Context, shortURL string) (*domain.URL, error) {
+	if u.ShortenURL == nil {
+		return nil, errs.ErrURLNotFound
+	}
+	if u.ShortenURL.IsDeleted || u.ShortenURL.IsExpired(time.Now()) {
+		return nil, errs.ErrURLDeleted
+	}
+	return u.ShortenURL, nil
+}
+
+func (u *MockShortenerService) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchItemResult, error) {
+	results := make([]BatchItemResult, len(items))
+	for i, item := range items {
+		url, err := u.Shorten(item.OriginalURL, ctx)
+		if err != nil {
+			return nil, err
 		}
+		results[i] = BatchItemResult{CorrelationID: item.CorrelationID, Status: model.BatchItemCreated, URL: url}
 	}
-	return nil
+	return results, nil
 }
 
-func (u *MockShortenerService) GetByUserID(ctx context.Context) (*[]domain.URL, error) {
+func (u *MockShortenerService) ListUserURLs(ctx context.Context, options ListURLsOptions) (*URLPage, error) {
 	if u.ShortenURL == nil {
 		return nil, errors.New("shorten service not found")
 	}
-	urls := []domain.URL{*u.ShortenURL}
-	return &urls, nil
+	return &URLPage{URLs: []domain.URL{*u.ShortenURL}}, nil
 }
-func (u *MockShortenerService) GetFlagByShortURL(ctx context.Context, shortURL string) (bool, error) {
-	return false, nil
+
+func (u *MockShortenerService) DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch) (*domain.DeleteJob, error) {
+	return domain.NewDeleteJob("testJobID", deleteBatch.UserID, deleteBatch.ShortenedURL, time.Now()), nil
 }
 
-func (u *MockShortenerService) DeleteURLBatch(ctx context.Context, deleteBatch model.DeleteBatch) {
+func (u *MockShortenerService) GetDeleteJob(ctx context.Context, id string) (*domain.DeleteJob, error) {
+	return nil, errs.ErrJobNotFound
+}
 
+func (u *MockShortenerService) Update(ctx context.Context, shortURL string, options UpdateOptions) (*domain.URL, error) {
+	u.LastUpdate = options
+	if u.UpdateErr != nil {
+		return nil, u.UpdateErr
+	}
+	if u.ShortenURL == nil {
+		return nil, errors.New("shorten service not found")
+	}
+	if options.OriginalURL != nil {
+		u.ShortenURL.OriginalURL = *options.OriginalURL
+	}
+	return u.ShortenURL, nil
 }
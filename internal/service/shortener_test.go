@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/model"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShortenBatch(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	if err := repo.Add(domain.NewURL("taken", "https://old.example/", "user", false), ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewURLService(repo, &stubGenerator{ids: []string{"taken", "a", "b", "c"}}, repository.DedupeGlobal, canonical.Options{}, nil)
+	results, err := s.ShortenBatch(ctx, []BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://new.example/"},
+		{CorrelationID: "2", OriginalURL: "https://old.example/"},
+		{CorrelationID: "3", OriginalURL: ""},
+		{CorrelationID: "1", OriginalURL: "https://dup-id.example/"},
+		{CorrelationID: "4", OriginalURL: "https://other.example/", Tags: []string{" Work ", "news", "work"}},
+		{CorrelationID: "5", OriginalURL: "https://new.example/"},
+		{CorrelationID: "6", OriginalURL: "https://tagged.example/", Tags: []string{"no spaces"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		status  string
+		shortID string
+		err     error
+	}{
+		{status: model.BatchItemCreated, shortID: "c"},
+		{status: model.BatchItemExisted, shortID: "taken"},
+		{status: model.BatchItemInvalid, err: errs.ErrEmptyURL},
+		{status: model.BatchItemInvalid, err: errs.ErrDuplicateCorrelationID},
+		{status: model.BatchItemCreated, shortID: "b"},
+		{status: model.BatchItemExisted, shortID: "c"},
+		{status: model.BatchItemInvalid, err: errs.ErrInvalidTag},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("ShortenBatch() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		result := results[i]
+		if result.Status != w.status || !errors.Is(result.Err, w.err) {
+			t.Errorf("result[%d] = %s/%v, want %s/%v", i, result.Status, result.Err, w.status, w.err)
+			continue
+		}
+		if w.shortID != "" && (result.URL == nil || result.URL.ID != w.shortID) {
+			t.Errorf("result[%d].URL = %+v, want short id %s", i, result.URL, w.shortID)
+		}
+	}
+	if results[3].CorrelationID != "1" {
+		t.Errorf("correlation_id is not echoed back: %q", results[3].CorrelationID)
+	}
+
+	if _, err := repo.Get("1", ctx); !errors.Is(err, errs.ErrURLNotFound) {
+		t.Errorf("correlation_id was stored as short id: %v", err)
+	}
+	if tagged, err := repo.Get("b", ctx); err != nil || !reflect.DeepEqual(tagged.Tags, []string{"news", "work"}) {
+		t.Errorf("stored tags = %v, %v, want [news work]", tagged, err)
+	}
+}
+
+func TestShortenBatchWithoutDedupe(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeNone)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+
+	s := NewURLService(repo, &stubGenerator{ids: []string{"a", "b"}}, repository.DedupeNone, canonical.Options{}, nil)
+	results, err := s.ShortenBatch(ctx, []BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://same.example/"},
+		{CorrelationID: "2", OriginalURL: "https://same.example/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []string{"a", "b"} {
+		if results[i].Status != model.BatchItemCreated || results[i].URL.ID != id {
+			t.Errorf("result[%d] = %s/%+v, want created %s", i, results[i].Status, results[i].URL, id)
+		}
+	}
+}
+
+func TestShortenDedupesCanonicalURL(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	options := canonical.Options{SortQuery: true, StripTracking: true}
+	s := NewURLService(repo, &stubGenerator{ids: []string{"a", "b", "c"}}, repository.DedupeGlobal, options, nil)
+
+	url, err := s.Shorten("HTTPS://Example.COM:443/docs?b=2&a=1&utm_source=mail", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url.CanonicalURL != "https://example.com/docs?a=1&b=2" {
+		t.Errorf("CanonicalURL = %q", url.CanonicalURL)
+	}
+	if url.OriginalURL != "HTTPS://Example.COM:443/docs?b=2&a=1&utm_source=mail" {
+		t.Errorf("OriginalURL = %q, want submitted form", url.OriginalURL)
+	}
+
+	var existingErr *errs.OriginalURLAlreadyExists
+	if _, err := s.Shorten("https://example.com/docs?a=1&b=2&fbclid=x", ctx); !errors.As(err, &existingErr) || existingErr.URL.ID != "a" {
+		t.Errorf("equivalent URL error = %v, want existing link a", err)
+	}
+
+	results, err := s.ShortenBatch(ctx, []BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://batch.example/x"},
+		{CorrelationID: "2", OriginalURL: "https://BATCH.example:443/%78"},
+		{CorrelationID: "3", OriginalURL: "https://bad host/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1].Status != model.BatchItemExisted || results[1].URL.ID != results[0].URL.ID {
+		t.Errorf("result[1] = %s/%+v, want existed %+v", results[1].Status, results[1].URL, results[0].URL)
+	}
+	if results[2].Status != model.BatchItemInvalid || !errors.Is(results[2].Err, errs.ErrInvalidURL) {
+		t.Errorf("result[2] = %s/%v, want invalid url", results[2].Status, results[2].Err)
+	}
+}
+
+func TestShortenValidatesURL(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	validator, err := NewURLValidator(URLValidationOptions{AllowedSchemes: []string{"http", "https"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewURLService(repo, &stubGenerator{ids: []string{"a", "b"}}, repository.DedupeGlobal, canonical.Options{}, validator)
+
+	if _, err := s.Shorten("javascript:alert(1)", ctx); !errors.Is(err, errs.ErrInvalidURL) {
+		t.Errorf("Shorten() error = %v, want %v", err, errs.ErrInvalidURL)
+	}
+	results, err := s.ShortenBatch(ctx, []BatchItem{
+		{CorrelationID: "1", OriginalURL: "http://localhost/"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidURLErr := new(errs.InvalidURL)
+	if results[0].Status != model.BatchItemInvalid || !errors.As(results[0].Err, &invalidURLErr) || invalidURLErr.Rule != errs.URLRulePrivateHost {
+		t.Errorf("result[0] = %s/%v, want invalid private host", results[0].Status, results[0].Err)
+	}
+	if results[1].Status != model.BatchItemCreated || results[1].URL.ID != "a" {
+		t.Errorf("result[1] = %s/%+v, want created a", results[1].Status, results[1].URL)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	middleware.Initialize()
+
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	other := context.WithValue(context.Background(), middleware.UserID{}, "other")
+	future := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	recentlyExpired := time.Now().Add(-time.Minute)
+	longExpired := time.Now().Add(-time.Hour)
+	newURL := "https://new.example/"
+	takenURL := "https://taken.example/"
+	noTags := []string{}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		id      string
+		options UpdateOptions
+		wantErr error
+		check   func(t *testing.T, url *domain.URL)
+	}{
+		{name: "nothing to update", ctx: ctx, id: "a", wantErr: errs.ErrInvalidUpdate},
+		{name: "other user's link", ctx: other, id: "a", options: UpdateOptions{OriginalURL: &newURL}, wantErr: errs.ErrURLNotFound},
+		{name: "unknown link", ctx: ctx, id: "missing", options: UpdateOptions{OriginalURL: &newURL}, wantErr: errs.ErrURLNotFound},
+		{name: "deleted link", ctx: ctx, id: "deleted", options: UpdateOptions{OriginalURL: &newURL}, wantErr: errs.ErrURLDeleted},
+		{name: "expired link before cleanup", ctx: ctx, id: "expired", options: UpdateOptions{ClearExpiry: true}, wantErr: errs.ErrURLDeleted},
+		{name: "expired link after cleanup", ctx: ctx, id: "reaped", options: UpdateOptions{TTL: 3600}, wantErr: errs.ErrURLDeleted},
+		{name: "changed url is a duplicate", ctx: ctx, id: "a", options: UpdateOptions{OriginalURL: &takenURL}, wantErr: new(errs.OriginalURLAlreadyExists)},
+		{name: "ttl and expires_at", ctx: ctx, id: "a", options: UpdateOptions{ExpiresAt: &future, TTL: 60}, wantErr: errs.ErrInvalidExpiry},
+		{name: "clear expiry and ttl", ctx: ctx, id: "a", options: UpdateOptions{ClearExpiry: true, TTL: 60}, wantErr: errs.ErrInvalidExpiry},
+		{
+			name: "change url", ctx: ctx, id: "a", options: UpdateOptions{OriginalURL: &newURL},
+			check: func(t *testing.T, url *domain.URL) {
+				if url.OriginalURL != newURL || url.CanonicalURL != newURL {
+					t.Errorf("url = %q/%q, want %q", url.OriginalURL, url.CanonicalURL, newURL)
+				}
+			},
+		},
+		{
+			name: "ttl", ctx: ctx, id: "a", options: UpdateOptions{TTL: 3600},
+			check: func(t *testing.T, url *domain.URL) {
+				if url.ExpiresAt == nil || time.Until(*url.ExpiresAt) < 59*time.Minute || time.Until(*url.ExpiresAt) > time.Hour {
+					t.Errorf("ExpiresAt = %v, want in an hour", url.ExpiresAt)
+				}
+			},
+		},
+		{
+			name: "explicit expires_at", ctx: ctx, id: "a", options: UpdateOptions{ExpiresAt: &future},
+			check: func(t *testing.T, url *domain.URL) {
+				if url.ExpiresAt == nil || !url.ExpiresAt.Equal(future) {
+					t.Errorf("ExpiresAt = %v, want %v", url.ExpiresAt, future)
+				}
+			},
+		},
+		{
+			name: "clear expiry", ctx: ctx, id: "a", options: UpdateOptions{ClearExpiry: true},
+			check: func(t *testing.T, url *domain.URL) {
+				if url.ExpiresAt != nil {
+					t.Errorf("ExpiresAt = %v, want nil", url.ExpiresAt)
+				}
+			},
+		},
+		{
+			name: "replace tags with empty list", ctx: ctx, id: "a", options: UpdateOptions{Tags: &noTags},
+			check: func(t *testing.T, url *domain.URL) {
+				if len(url.Tags) != 0 {
+					t.Errorf("Tags = %v, want none", url.Tags)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+			s := NewURLService(repo, &stubGenerator{}, repository.DedupeGlobal, canonical.Options{}, nil)
+			expiring := domain.NewURL("a", "https://a.example/", "user", false)
+			expiring.ExpiresAt = &future
+			expiring.Tags = []string{"work"}
+			expired := domain.NewURL("expired", "https://expired.example/", "user", false)
+			expired.ExpiresAt = &recentlyExpired
+			reaped := domain.NewURL("reaped", "https://reaped.example/", "user", false)
+			reaped.ExpiresAt = &longExpired
+			for _, url := range []*domain.URL{expiring, domain.NewURL("deleted", "https://deleted.example/", "user", false),
+				domain.NewURL("taken", takenURL, "user", false), expired, reaped} {
+				if err := repo.Add(url, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := repo.DeleteURLBatch(ctx, []repository.UserShortURL{{UserID: "user", ShortURL: "deleted"}}); err != nil {
+				t.Fatal(err)
+			}
+			// Очистка дошла только до reaped
+			if _, err := repo.DeleteExpired(ctx, longExpired); err != nil {
+				t.Fatal(err)
+			}
+
+			url, err := s.Update(tt.ctx, tt.id, tt.options)
+			if tt.wantErr != nil {
+				if existingErr, ok := tt.wantErr.(*errs.OriginalURLAlreadyExists); ok {
+					if !errors.As(err, &existingErr) || existingErr.URL.ID != "taken" {
+						t.Errorf("Update() error = %v, want existing link taken", err)
+					}
+					return
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Update() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, url)
+
+			stored, err := repo.Get(tt.id, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, stored)
+		})
+	}
+}
+
+func TestListUserURLsPagination(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	s := NewURLService(repo, &stubGenerator{ids: []string{"a", "b", "c"}}, repository.DedupeGlobal, canonical.Options{}, nil)
+	for _, original := range []string{"https://a.example/", "https://b.example/", "https://c.example/"} {
+		if _, err := s.Shorten(original, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	options := ListURLsOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatal("pagination does not terminate")
+		}
+		page, err := s.ListUserURLs(ctx, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, url := range page.URLs {
+			got = append(got, url.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("paginated ids = %v, want [a b c]", got)
+	}
+
+	for _, options := range []ListURLsOptions{{Cursor: "not-a-cursor"}, {Limit: MaxPageLimit + 1}} {
+		if _, err := s.ListUserURLs(ctx, options); !errors.Is(err, errs.ErrInvalidPage) {
+			t.Errorf("ListUserURLs(%+v) error = %v, want %v", options, err, errs.ErrInvalidPage)
+		}
+	}
+}
+
+func TestListUserURLsTreatsExpiredAsDeleted(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	expiresAt := time.Now().Add(-time.Minute)
+	expired := domain.NewURL("expired", "https://expired.example/", "user", false)
+	expired.ExpiresAt = &expiresAt
+	for _, url := range []*domain.URL{domain.NewURL("live", "https://live.example/", "user", false), expired} {
+		if err := repo.Add(url, ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewURLService(repo, &stubGenerator{}, repository.DedupeGlobal, canonical.Options{}, nil)
+
+	page, err := s.ListUserURLs(ctx, ListURLsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.URLs) != 1 || page.URLs[0].ID != "live" {
+		t.Errorf("ListUserURLs() = %+v, want only live", page.URLs)
+	}
+
+	page, err = s.ListUserURLs(ctx, ListURLsOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range page.URLs {
+		if url.ID == "expired" && !url.IsDeleted {
+			t.Errorf("expired link listed as not deleted: %+v", url)
+		}
+	}
+	if len(page.URLs) != 2 {
+		t.Errorf("ListUserURLs(include deleted) returned %d urls, want 2", len(page.URLs))
+	}
+}
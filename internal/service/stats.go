@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"time"
+)
+
+const (
+	clickBufferSize    = 1024
+	clickBatchSize     = 100
+	clickFlushInterval = time.Second
+)
+
+type ClickRecorder interface {
+	Record(shortURL, referrer, userAgent, remoteIP string)
+}
+
+type StatsServiceReader interface {
+	GetStats(ctx context.Context, shortURL string) (*domain.ClickStats, error)
+}
+
+// StatsService пишет переходы в репозиторий пачками из фоновой горутины,
+// чтобы запись кликов не замедляла редирект.
+type StatsService struct {
+	repo   repository.Repository
+	clicks chan domain.Click
+	ipSalt string
+}
+
+func NewStatsService(repo repository.Repository, ipSalt string) *StatsService {
+	return &StatsService{
+		repo:   repo,
+		clicks: make(chan domain.Click, clickBufferSize),
+		ipSalt: ipSalt,
+	}
+}
+
+// Record не блокируется: если буфер переполнен, клик отбрасывается.
+func (s *StatsService) Record(shortURL, referrer, userAgent, remoteIP string) {
+	click := domain.Click{
+		ShortURL:  shortURL,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IPHash:    hashIP(remoteIP, s.ipSalt),
+	}
+
+	select {
+	case s.clicks <- click:
+	default:
+		middleware.Log.Warnw("click buffer is full, dropping click", "short_url", shortURL)
+	}
+}
+
+func (s *StatsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]domain.Click, 0, clickBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			// дописываем то, что успело накопиться в буфере
+			for {
+				select {
+				case click := <-s.clicks:
+					batch = append(batch, click)
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		case click := <-s.clicks:
+			batch = append(batch, click)
+			if len(batch) >= clickBatchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *StatsService) flush(batch []domain.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.repo.AddClicks(ctxWithTimeout, batch); err != nil {
+		middleware.Log.Errorw("failed to save clicks", "count", len(batch), "error", err)
+	}
+}
+
+func (s *StatsService) GetStats(ctx context.Context, shortURL string) (*domain.ClickStats, error) {
+	url, err := s.repo.Get(shortURL, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if url.UserID != middleware.GetUserID(ctx) {
+		return nil, errs.ErrNotURLOwner
+	}
+	if url.IsDeleted {
+		return nil, errs.ErrURLDeleted
+	}
+	return s.repo.GetClickStats(ctx, shortURL)
+}
+
+func hashIP(ip, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+)
+
+type MockStatsService struct {
+	Clicks []domain.Click
+	Stats  *domain.ClickStats
+	Err    error
+}
+
+func NewMockStatsService() *MockStatsService {
+	return &MockStatsService{}
+}
+
+func (s *MockStatsService) Record(shortURL, referrer, userAgent, remoteIP string) {
+	s.Clicks = append(s.Clicks, domain.Click{
+		ShortURL:  shortURL,
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IPHash:    remoteIP,
+	})
+}
+
+func (s *MockStatsService) GetStats(ctx context.Context, shortURL string) (*domain.ClickStats, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if s.Stats == nil {
+		return nil, errors.New("stats not found")
+	}
+	return s.Stats, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecordingRepository запоминает размеры пачек, с которыми вызывается AddClicks.
+type batchRecordingRepository struct {
+	repository.Repository
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecordingRepository) AddClicks(ctx context.Context, clicks []domain.Click) error {
+	r.mu.Lock()
+	r.batches = append(r.batches, len(clicks))
+	r.mu.Unlock()
+	return r.Repository.AddClicks(ctx, clicks)
+}
+
+func (r *batchRecordingRepository) flushed() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+func TestStatsServiceBatchesClicks(t *testing.T) {
+	middleware.Initialize()
+
+	ram, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	repo := &batchRecordingRepository{Repository: ram}
+	s := NewStatsService(repo, "salt")
+	for i := 0; i < clickBatchSize+5; i++ {
+		s.Record("abc", "", "", "10.0.0.1")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(clickFlushInterval / 2)
+	for len(repo.flushed()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// полная пачка уходит сразу, остаток дописывается при остановке
+	if got := repo.flushed(); !reflect.DeepEqual(got, []int{clickBatchSize, 5}) {
+		t.Errorf("AddClicks batches = %v, want [%d 5]", got, clickBatchSize)
+	}
+	stats, err := ram.GetClickStats(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalClicks != clickBatchSize+5 || stats.UniqueVisitors != 1 {
+		t.Errorf("stats = %d clicks/%d visitors, want %d/1", stats.TotalClicks, stats.UniqueVisitors, clickBatchSize+5)
+	}
+}
+
+func TestStatsServiceGetStats(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	owner := context.WithValue(context.Background(), middleware.UserID{}, "owner")
+	other := context.WithValue(context.Background(), middleware.UserID{}, "other")
+	for _, id := range []string{"live", "gone"} {
+		if err := repo.Add(domain.NewURL(id, "https://"+id+".example/", "owner", false), owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.DeleteURLBatch(owner, []repository.UserShortURL{{UserID: "owner", ShortURL: "gone"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStatsService(repo, "salt")
+	if stats, err := s.GetStats(owner, "live"); err != nil || stats.ShortURL != "live" {
+		t.Errorf("GetStats(owner) = %+v, %v", stats, err)
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		shortURL string
+		want     error
+	}{
+		{name: "other user", ctx: other, shortURL: "live", want: errs.ErrNotURLOwner},
+		{name: "unknown", ctx: owner, shortURL: "missing", want: errs.ErrURLNotFound},
+		{name: "deleted", ctx: owner, shortURL: "gone", want: errs.ErrURLDeleted},
+	}
+	for _, tt := range tests {
+		if _, err := s.GetStats(tt.ctx, tt.shortURL); !errors.Is(err, tt.want) {
+			t.Errorf("%s: GetStats() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"sort"
+	"strings"
+)
+
+const (
+	tagMaxLength = 50
+	maxURLTags   = 20
+)
+
+// NormalizeTags приводит теги к нижнему регистру, убирает повторы и сортирует.
+// Тег — от 1 до tagMaxLength букв, цифр, '-', '_' или '.'.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{}, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if _, duplicate := seen[tag]; duplicate {
+			continue
+		}
+		seen[tag] = struct{}{}
+		result = append(result, tag)
+	}
+	if len(result) > maxURLTags {
+		return nil, fmt.Errorf("%w: a link can have at most %d tags", errs.ErrInvalidTag, maxURLTags)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > tagMaxLength {
+		return "", fmt.Errorf("%w: %q must be between 1 and %d characters", errs.ErrInvalidTag, tag, tagMaxLength)
+	}
+	for _, c := range tag {
+		isLetter := c >= 'a' && c <= 'z'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '-' && c != '_' && c != '.' {
+			return "", fmt.Errorf("%w: %q may contain only latin letters, digits, '-', '_' and '.'", errs.ErrInvalidTag, tag)
+		}
+	}
+	return tag, nil
+}
+
+type TagServiceManager interface {
+	ListTags(ctx context.Context) ([]domain.TagCount, error)
+	RenameTag(ctx context.Context, name, newName string) error
+	MergeTags(ctx context.Context, sources []string, target string) error
+}
+
+type TagService struct {
+	repo repository.Repository
+}
+
+func NewTagService(repo repository.Repository) *TagService {
+	return &TagService{repo: repo}
+}
+
+func (s *TagService) ListTags(ctx context.Context) ([]domain.TagCount, error) {
+	return s.repo.GetTags(ctx, middleware.GetUserID(ctx))
+}
+
+// RenameTag — слияние одного тега; переименование в существующий тег объединяет их.
+func (s *TagService) RenameTag(ctx context.Context, name, newName string) error {
+	return s.MergeTags(ctx, []string{name}, newName)
+}
+
+func (s *TagService) MergeTags(ctx context.Context, sources []string, target string) error {
+	target, err := NormalizeTag(target)
+	if err != nil {
+		return err
+	}
+	normalized := make([]string, 0, len(sources))
+	for _, source := range sources {
+		source, err := NormalizeTag(source)
+		if err != nil {
+			return err
+		}
+		if source != target {
+			normalized = append(normalized, source)
+		}
+	}
+	if len(normalized) == 0 {
+		return fmt.Errorf("%w: no tags to merge into %q", errs.ErrInvalidTag, target)
+	}
+	return s.repo.MergeTags(ctx, middleware.GetUserID(ctx), normalized, target)
+}
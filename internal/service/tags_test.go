@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/canonical"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tooMany := make([]string, maxURLTags+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("t", i+1)
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no tags", tags: nil, want: nil},
+		{name: "sorted and deduplicated", tags: []string{" News", "go", "news"}, want: []string{"go", "news"}},
+		{name: "allowed punctuation", tags: []string{"v1.2_beta-x"}, want: []string{"v1.2_beta-x"}},
+		{name: "empty tag", tags: []string{"  "}, wantErr: true},
+		{name: "too long", tags: []string{strings.Repeat("a", tagMaxLength+1)}, wantErr: true},
+		{name: "forbidden characters", tags: []string{"a,b"}, wantErr: true},
+		{name: "too many tags", tags: tooMany, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeTags(%q) error = %v, wantErr %v", tt.tags, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errs.ErrInvalidTag) {
+				t.Errorf("NormalizeTags(%q) error = %v, want %v", tt.tags, err, errs.ErrInvalidTag)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagServiceRenameAndMerge(t *testing.T) {
+	middleware.Initialize()
+
+	repo, _ := repository.NewRAMRepository(repository.DedupeGlobal)
+	ctx := context.WithValue(context.Background(), middleware.UserID{}, "user")
+	urls := NewURLService(repo, &stubGenerator{ids: []string{"a", "b"}}, repository.DedupeGlobal, canonical.Options{}, nil)
+	if _, err := urls.ShortenWithOptions("https://a.example/", ShortenOptions{Tags: []string{"Golang"}}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := urls.ShortenWithOptions("https://b.example/", ShortenOptions{Tags: []string{"go-lang", "news"}}, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := NewTagService(repo)
+	if err := tags.MergeTags(ctx, []string{"golang", "GO-LANG", "go"}, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.RenameTag(ctx, "news", "NEWS"); !errors.Is(err, errs.ErrInvalidTag) {
+		t.Errorf("RenameTag() into itself error = %v, want %v", err, errs.ErrInvalidTag)
+	}
+	if err := tags.RenameTag(ctx, "missing", "other"); !errors.Is(err, errs.ErrTagNotFound) {
+		t.Errorf("RenameTag() of a missing tag error = %v, want %v", err, errs.ErrTagNotFound)
+	}
+
+	got, err := tags.ListTags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.TagCount{{Name: "go", Count: 2}, {Name: "news", Count: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTags() = %v, want %v", got, want)
+	}
+}
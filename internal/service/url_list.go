@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/domain"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"github.com/pervukhinpm/link-shortener.git/internal/middleware"
+	"github.com/pervukhinpm/link-shortener.git/internal/repository"
+	"github.com/pervukhinpm/link-shortener.git/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+type ListURLsOptions struct {
+	// Limit — размер страницы, 0 означает DefaultPageLimit.
+	Limit int
+	// Cursor — непрозрачный курсор из URLPage.NextCursor предыдущей страницы.
+	Cursor         string
+	Descending     bool
+	IncludeDeleted bool
+	Search         string
+	Tag            string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+}
+
+type URLPage struct {
+	URLs []domain.URL
+	// NextCursor пуст на последней странице.
+	NextCursor string
+}
+
+// ListUserURLs возвращает страницу ссылок текущего пользователя, упорядоченных по времени создания.
+func (u *ShortenerService) ListUserURLs(ctx context.Context, options ListURLsOptions) (_ *URLPage, err error) {
+	ctx, span := tracing.Start(ctx, "ShortenerService.ListUserURLs", attribute.Int("page.limit", options.Limit))
+	defer func() { tracing.End(span, err) }()
+
+	if options.Limit == 0 {
+		options.Limit = DefaultPageLimit
+	}
+	if options.Limit < 0 || options.Limit > MaxPageLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", errs.ErrInvalidPage, MaxPageLimit)
+	}
+
+	// Лишняя запись показывает, что за страницей есть продолжение
+	now := time.Now()
+	query := repository.URLPageQuery{
+		Now:            now,
+		UserID:         middleware.GetUserID(ctx),
+		Limit:          options.Limit + 1,
+		Descending:     options.Descending,
+		IncludeDeleted: options.IncludeDeleted,
+		Search:         options.Search,
+		CreatedAfter:   options.CreatedAfter,
+		CreatedBefore:  options.CreatedBefore,
+	}
+	if options.Tag != "" {
+		if query.Tag, err = NormalizeTag(options.Tag); err != nil {
+			return nil, err
+		}
+	}
+	if options.Cursor != "" {
+		cursor, err := DecodeURLCursor(options.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor
+	}
+
+	urls, err := u.repo.GetURLsPage(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Истёкшие ссылки показываются удалёнными независимо от того, дошла ли до них очистка
+	for i := range urls {
+		if urls[i].IsExpired(now) {
+			urls[i].IsDeleted = true
+		}
+	}
+
+	page := &URLPage{URLs: urls}
+	if len(urls) > options.Limit {
+		page.URLs = urls[:options.Limit]
+		last := page.URLs[len(page.URLs)-1]
+		page.NextCursor = EncodeURLCursor(repository.URLCursor{CreatedAt: last.CreatedAt, ShortURL: last.ID})
+	}
+	return page, nil
+}
+
+type urlCursorPayload struct {
+	CreatedAt time.Time `json:"t"`
+	ShortURL  string    `json:"id"`
+}
+
+func EncodeURLCursor(cursor repository.URLCursor) string {
+	data, _ := json.Marshal(urlCursorPayload{CreatedAt: cursor.CreatedAt, ShortURL: cursor.ShortURL})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeURLCursor(value string) (*repository.URLCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", errs.ErrInvalidPage)
+	}
+	var payload urlCursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ShortURL == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", errs.ErrInvalidPage)
+	}
+	return &repository.URLCursor{CreatedAt: payload.CreatedAt, ShortURL: payload.ShortURL}, nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// DefaultShorteners — известные сокращатели: ссылка на них прятала бы настоящий адрес
+// за двумя редиректами.
+var DefaultShorteners = []string{
+	"bit.ly", "buff.ly", "clck.ru", "cutt.ly", "goo.gl", "is.gd", "ow.ly", "rebrand.ly", "t.co", "tinyurl.com",
+}
+
+type URLValidationOptions struct {
+	AllowedSchemes []string
+	// MaxLength — максимальная длина URL в байтах, 0 снимает ограничение.
+	MaxLength int
+	// AllowPrivateHosts разрешает loopback, приватные и link-local адреса.
+	AllowPrivateHosts bool
+	// BaseURL — адрес самого сервиса: ссылки на него зацикливают редиректы.
+	BaseURL string
+	// Shorteners запрещаются вместе с поддоменами.
+	Shorteners []string
+}
+
+// Диапазоны, не покрытые методами netip.Addr: «этот» сегмент сети и CGNAT.
+var extraPrivatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+type URLValidator struct {
+	schemes           []string
+	maxLength         int
+	allowPrivateHosts bool
+	// selfHost — имя хоста из BaseURL, пустое, если BaseURL не задан. Порт не
+	// сравнивается: за прокси сервис отвечает на стандартном порту, а BaseURL из
+	// конфигурации всегда содержит порт самого сервера.
+	selfHost   string
+	shorteners map[string]struct{}
+}
+
+func NewURLValidator(options URLValidationOptions) (*URLValidator, error) {
+	v := &URLValidator{
+		maxLength:         options.MaxLength,
+		allowPrivateHosts: options.AllowPrivateHosts,
+		shorteners:        make(map[string]struct{}, len(options.Shorteners)),
+	}
+	for _, scheme := range options.AllowedSchemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			v.schemes = append(v.schemes, scheme)
+		}
+	}
+	if len(v.schemes) == 0 {
+		return nil, fmt.Errorf("no allowed url schemes")
+	}
+	for _, host := range options.Shorteners {
+		if host = strings.ToLower(strings.Trim(strings.TrimSpace(host), ".")); host != "" {
+			v.shorteners[host] = struct{}{}
+		}
+	}
+
+	if options.BaseURL != "" {
+		base := options.BaseURL
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+		u, err := url.Parse(base)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid base url %q", options.BaseURL)
+		}
+		v.selfHost = normalizeHost(u.Hostname())
+	}
+	return v, nil
+}
+
+// Validate проверяет URL до канонизации и возвращает *errs.InvalidURL с нарушенным правилом.
+// Хосты не резолвятся: проверяются только адреса, записанные в URL явно.
+func (v *URLValidator) Validate(raw string) error {
+	if v.maxLength > 0 && len(raw) > v.maxLength {
+		return errs.NewInvalidURL(raw, errs.URLRuleLength, fmt.Sprintf("url must be at most %d bytes long", v.maxLength))
+	}
+
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return errs.NewInvalidURL(raw, errs.URLRuleMalformed, err.Error())
+	}
+	if !v.allowsScheme(u.Scheme) {
+		return errs.NewInvalidURL(raw, errs.URLRuleScheme, fmt.Sprintf("scheme must be one of: %s", strings.Join(v.schemes, ", ")))
+	}
+	host := normalizeHost(u.Hostname())
+	if host == "" {
+		return errs.NewInvalidURL(raw, errs.URLRuleMalformed, "url must have a host")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil && endsInNumber(host) {
+		// Такие хосты браузер читает как IPv4 в сокращённой или десятичной записи
+		return errs.NewInvalidURL(raw, errs.URLRuleMalformed, fmt.Sprintf("host %q is an ip address in non-standard notation", host))
+	}
+	if !v.allowPrivateHosts && (isLocalhost(host) || err == nil && isPrivateAddr(addr)) {
+		return errs.NewInvalidURL(raw, errs.URLRulePrivateHost, fmt.Sprintf("host %q is a private or loopback address", host))
+	}
+
+	if v.selfHost != "" && host == v.selfHost {
+		return errs.NewInvalidURL(raw, errs.URLRuleSelfReference, "url points to this shortener")
+	}
+	if shortener := v.shortenerOf(host); shortener != "" {
+		return errs.NewInvalidURL(raw, errs.URLRuleNestedShortener, fmt.Sprintf("%s links are already short", shortener))
+	}
+	return nil
+}
+
+func (v *URLValidator) allowsScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	for _, allowed := range v.schemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *URLValidator) shortenerOf(host string) string {
+	for {
+		if _, ok := v.shorteners[host]; ok {
+			return host
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return ""
+		}
+		host = host[dot+1:]
+	}
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range extraPrivatePrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsInNumber — последняя метка хоста десятичное или 0x-шестнадцатеричное число.
+func endsInNumber(host string) bool {
+	label := host[strings.LastIndexByte(host, '.')+1:]
+	if strings.HasPrefix(label, "0x") {
+		label = label[2:]
+		return strings.Trim(label, "0123456789abcdef") == ""
+	}
+	return label != "" && strings.Trim(label, "0123456789") == ""
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"github.com/pervukhinpm/link-shortener.git/internal/errs"
+	"strings"
+	"testing"
+)
+
+func TestURLValidator(t *testing.T) {
+	v, err := NewURLValidator(URLValidationOptions{
+		AllowedSchemes: []string{"http", "HTTPS"},
+		MaxLength:      64,
+		BaseURL:        "https://sho.rt",
+		Shorteners:     DefaultShorteners,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{url: "https://practicum.yandex.ru/"},
+		{url: "HTTP://Example.com:8080/path?q=1"},
+		{url: "http://8.8.8.8/"},
+		{url: "https://bitly.com/"},
+		{url: "https://example.com/" + strings.Repeat("a", 64), rule: errs.URLRuleLength},
+		{url: "javascript:alert(1)", rule: errs.URLRuleScheme},
+		{url: "just some text", rule: errs.URLRuleScheme},
+		{url: "ftp://example.com/file", rule: errs.URLRuleScheme},
+		{url: "http://%zz/", rule: errs.URLRuleMalformed},
+		{url: "http:///path", rule: errs.URLRuleMalformed},
+		{url: "http://2130706433/", rule: errs.URLRuleMalformed},
+		{url: "http://0x7f.1/", rule: errs.URLRuleMalformed},
+		{url: "http://localhost:8080/", rule: errs.URLRulePrivateHost},
+		{url: "http://127.0.0.1/", rule: errs.URLRulePrivateHost},
+		{url: "http://10.1.2.3/", rule: errs.URLRulePrivateHost},
+		{url: "http://169.254.169.254/latest/meta-data", rule: errs.URLRulePrivateHost},
+		{url: "http://[::1]/", rule: errs.URLRulePrivateHost},
+		{url: "http://[::ffff:192.168.0.1]/", rule: errs.URLRulePrivateHost},
+		{url: "https://SHO.RT/abc", rule: errs.URLRuleSelfReference},
+		{url: "https://sho.rt:443/abc", rule: errs.URLRuleSelfReference},
+		{url: "http://sho.rt:9000/abc", rule: errs.URLRuleSelfReference},
+		{url: "https://go.sho.rt/abc"},
+		{url: "https://bit.ly/abc", rule: errs.URLRuleNestedShortener},
+		{url: "https://www.tinyurl.com/abc", rule: errs.URLRuleNestedShortener},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := v.Validate(tt.url)
+			if tt.rule == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			invalidURLErr := new(errs.InvalidURL)
+			if !errors.As(err, &invalidURLErr) || invalidURLErr.Rule != tt.rule {
+				t.Errorf("Validate() error = %v, want rule %s", err, tt.rule)
+			}
+			if !errors.Is(err, errs.ErrInvalidURL) {
+				t.Errorf("Validate() error %v is not errs.ErrInvalidURL", err)
+			}
+		})
+	}
+
+	// Конфигурация всегда дописывает к BaseURL порт сервера
+	configured, err := NewURLValidator(URLValidationOptions{AllowedSchemes: []string{"https"}, BaseURL: "https://sho.rt:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configured.Validate("https://sho.rt/x"); !errors.Is(err, errs.ErrInvalidURL) {
+		t.Errorf("Validate() behind proxy error = %v, want self reference", err)
+	}
+
+	private, err := NewURLValidator(URLValidationOptions{AllowedSchemes: []string{"http"}, AllowPrivateHosts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := private.Validate("http://127.0.0.1:8080/"); err != nil {
+		t.Errorf("Validate() with private hosts allowed error = %v, want nil", err)
+	}
+
+	if _, err := NewURLValidator(URLValidationOptions{}); err == nil {
+		t.Error("NewURLValidator() error = nil without allowed schemes")
+	}
+}
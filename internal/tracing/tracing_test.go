@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetupExportsToOTLPCollector(t *testing.T) {
+	var exports atomic.Int64
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	shutdown, err := Setup(ctx, Options{
+		Exporter:     ExporterOTLP,
+		OTLPEndpoint: strings.TrimPrefix(collector.URL, "http://"),
+		OTLPInsecure: true,
+		SampleRatio:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(ctx, "test")
+	span.End()
+
+	// Shutdown дожидается отправки накопленного батча
+	if err := shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if exports.Load() == 0 {
+		t.Fatal("collector received no traces")
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "jaeger"}); err == nil {
+		t.Fatal("Setup() error = nil, want unknown exporter error")
+	}
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	if _, err := Setup(context.Background(), Options{Exporter: ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	server := spans[1]
+	if server.Name() != "GET /{id}" {
+		t.Errorf("server span name = %q", server.Name())
+	}
+	if spans[0].Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("handler span is not a child of server span")
+	}
+	for _, span := range spans {
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("span %q trace id = %s, want %s", span.Name(), got, traceID)
+		}
+	}
+}